@@ -1,6 +1,8 @@
 package mytokenlib
 
 import (
+	"strings"
+
 	"github.com/oidc-mytoken/api/v0"
 )
 
@@ -8,28 +10,43 @@ import (
 // performed there.
 type AccessTokenEndpoint struct {
 	endpoint string
+	client   *client
 }
 
-func newAccessTokenEndpoint(endpoint string) *AccessTokenEndpoint {
+func newAccessTokenEndpoint(endpoint string, c *client) *AccessTokenEndpoint {
 	return &AccessTokenEndpoint{
 		endpoint: endpoint,
+		client:   c,
 	}
 }
 
 // DoHTTPRequest performs an http request to the access token endpoint
 func (at AccessTokenEndpoint) DoHTTPRequest(method string, req, resp interface{}) error {
-	return doHTTPRequest(method, at.endpoint, req, resp)
+	return at.client.doHTTPRequest(method, at.endpoint, req, resp)
 }
 
 // APIGet uses the passed mytoken to return an access token with the specified attributes. If a non-empty string
-// is passed as the oidcIssuer it must match the oidc issuer of the mytoken. If scopes and audiences are passed the
-// access token is requested with these parameters, if omitted the default values for this mytoken / provider are used.
-// Multiple scopes are passed as a space separated string. The comment details how the access token is intended to be
-// used.
+// is passed as the oidcIssuer it must match the oidc issuer of the mytoken; it can also be a provider alias if enabled
+// with WithIssuerAliases. If an empty oidcIssuer is passed, the issuer set with WithDefaultIssuer is used, if any.
+// If scopes and audiences are passed the access token is requested with these parameters, if omitted the default
+// values for this mytoken / provider are used. Multiple scopes are passed as a space separated string. The comment
+// details how the access token is intended to be used.
 // If the used mytoken changes (due to token rotation), the new mytoken is included in the api.AccessTokenResponse
 func (at AccessTokenEndpoint) APIGet(
 	mytoken string, oidcIssuer string, scopes, audiences []string, comment string,
 ) (resp api.AccessTokenResponse, err error) {
+	if err = at.client.requireGrantType(EndpointAccessToken, api.GrantTypeMytoken); err != nil {
+		return
+	}
+	if oidcIssuer == "" && at.client != nil {
+		oidcIssuer = at.client.defaultIssuer
+	}
+	if oidcIssuer, err = at.client.resolveIssuer(oidcIssuer); err != nil {
+		return
+	}
+	if err = at.client.validateScopes(oidcIssuer, strings.Fields(strings.Join(scopes, " "))); err != nil {
+		return
+	}
 	req := NewAccessTokenRequest(oidcIssuer, mytoken, scopes, audiences, comment)
 	err = at.DoHTTPRequest("POST", req, &resp)
 	return
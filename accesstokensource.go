@@ -0,0 +1,174 @@
+package mytokenlib
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/oidc-mytoken/api/v0"
+)
+
+// DefaultMinValidity is the default duration an access token returned by an AccessTokenSource must at least be valid
+const DefaultMinValidity = time.Minute
+
+// unknownAccessTokenLifetime is the lifetime assumed for access tokens if the server does not return expires_in
+const unknownAccessTokenLifetime = 5 * time.Minute
+
+// refreshRetryInterval is the interval after which a failed refresh is retried in a refresh loop
+const refreshRetryInterval = 30 * time.Second
+
+// AccessTokenSource obtains access tokens for a mytoken from an AccessTokenEndpoint and caches them until they are
+// about to expire. It is safe for concurrent use.
+// If the mytoken is rotated, the source continues with the updated mytoken and calls OnMytokenUpdate (if set).
+type AccessTokenSource struct {
+	// MinValidity is the duration an access token must at least be valid to be returned from the cache; if it is 0,
+	// DefaultMinValidity is used. For short-lived tokens at most half the token lifetime is used.
+	MinValidity time.Duration
+	// OnMytokenUpdate is called with the new mytoken whenever the mytoken was rotated
+	OnMytokenUpdate func(mytoken string)
+
+	endpoint  *AccessTokenEndpoint
+	issuer    string
+	scopes    []string
+	audiences []string
+	comment   string
+
+	mutex     sync.Mutex
+	mytoken   string
+	token     string
+	obtained  time.Time
+	expiresAt time.Time
+}
+
+// NewAccessTokenSource creates a new AccessTokenSource that uses the passed mytoken to obtain access tokens from the
+// passed AccessTokenEndpoint. The other parameters are used as in AccessTokenEndpoint.Get.
+func NewAccessTokenSource(
+	endpoint *AccessTokenEndpoint, mytoken, oidcIssuer string, scopes, audiences []string, comment string,
+) *AccessTokenSource {
+	return &AccessTokenSource{
+		endpoint:  endpoint,
+		mytoken:   mytoken,
+		issuer:    oidcIssuer,
+		scopes:    scopes,
+		audiences: audiences,
+		comment:   comment,
+	}
+}
+
+// Mytoken returns the mytoken currently used by this AccessTokenSource; it differs from the initial mytoken if the
+// mytoken was rotated.
+func (s *AccessTokenSource) Mytoken() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.mytoken
+}
+
+// Token returns a valid access token; a cached access token is returned if it is still valid for long enough,
+// otherwise a new one is obtained.
+func (s *AccessTokenSource) Token() (string, error) {
+	token, _, err := s.TokenWithExpiry()
+	return token, err
+}
+
+// TokenWithExpiry is like Token but additionally returns the time the access token expires
+func (s *AccessTokenSource) TokenWithExpiry() (string, time.Time, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.token != "" && s.clock().Now().Before(s.refreshAt()) {
+		return s.token, s.expiresAt, nil
+	}
+	return s.refresh()
+}
+
+// Refresh obtains a new access token, regardless of the cached one
+func (s *AccessTokenSource) Refresh() (string, time.Time, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.refresh()
+}
+
+// NextRefresh returns the time at which the cached access token should be refreshed; if no access token is cached
+// the zero time is returned.
+func (s *AccessTokenSource) NextRefresh() time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.token == "" {
+		return time.Time{}
+	}
+	return s.refreshAt()
+}
+
+func (s *AccessTokenSource) refreshAt() time.Time {
+	margin := s.MinValidity
+	if margin == 0 {
+		margin = DefaultMinValidity
+	}
+	if lifetime := s.expiresAt.Sub(s.obtained); margin > lifetime/2 {
+		margin = lifetime / 2
+	}
+	return s.expiresAt.Add(-margin)
+}
+
+// clock returns the Clock of the MytokenServer of the source's AccessTokenEndpoint
+func (s *AccessTokenSource) clock() Clock {
+	if s.endpoint == nil {
+		return systemClock{}
+	}
+	return s.endpoint.client.getClock()
+}
+
+func (s *AccessTokenSource) refresh() (string, time.Time, error) {
+	now := s.clock().Now()
+	resp, err := s.endpoint.APIGet(s.mytoken, s.issuer, s.scopes, s.audiences, s.comment)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	s.updateMytoken(resp)
+	lifetime := time.Duration(resp.ExpiresIn) * time.Second
+	if lifetime <= 0 {
+		lifetime = unknownAccessTokenLifetime
+	}
+	s.token = resp.AccessToken
+	s.obtained = now
+	s.expiresAt = now.Add(lifetime)
+	return s.token, s.expiresAt, nil
+}
+
+func (s *AccessTokenSource) updateMytoken(resp api.AccessTokenResponse) {
+	if resp.TokenUpdate == nil || resp.TokenUpdate.Mytoken == "" {
+		return
+	}
+	s.mytoken = resp.TokenUpdate.Mytoken
+	if s.OnMytokenUpdate != nil {
+		s.OnMytokenUpdate(s.mytoken)
+	}
+}
+
+// refreshLoop keeps the access tokens of the passed AccessTokenSource fresh until the context is done. The update
+// function is called with every newly obtained access token; errors from obtaining or handling a token are passed to
+// onError (if not nil) and the refresh is retried later.
+func (s *AccessTokenSource) refreshLoop(
+	ctx context.Context, update func(token string, expiresAt time.Time) error, onError func(error),
+) {
+	for {
+		wait := refreshRetryInterval
+		token, expiresAt, err := s.Refresh()
+		if err == nil {
+			err = update(token, expiresAt)
+		}
+		if err != nil {
+			if onError != nil {
+				onError(err)
+			}
+		} else if next := s.NextRefresh().Sub(s.clock().Now()); next > 0 {
+			wait = next
+		}
+		timer := s.clock().NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C():
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package mytokenlib
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAccessTokenSourceRefreshTiming(t *testing.T) {
+	tests := []struct {
+		name      string
+		expiresIn int64
+		refresh   time.Duration
+	}{
+		{name: "long-lived", expiresIn: 600, refresh: 9 * time.Minute},
+		// for short-lived tokens at most half the lifetime is used as margin
+		{name: "short-lived", expiresIn: 60, refresh: 30 * time.Second},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				start := time.Now()
+				clock := NewFakeClock(start)
+				var issued atomic.Int32
+				server := newTestMytokenServer(t, accessTokenHandler(test.expiresIn, &issued), nil, WithClock(clock))
+				source := NewAccessTokenSource(server.AccessToken, "mytoken", "", nil, nil, "")
+
+				token, expiresAt, err := source.TokenWithExpiry()
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if token != "at1" || !expiresAt.Equal(start.Add(time.Duration(test.expiresIn)*time.Second)) {
+					t.Fatalf("unexpected token %q expiring at %s", token, expiresAt)
+				}
+				if next := source.NextRefresh(); !next.Equal(start.Add(test.refresh)) {
+					t.Errorf("expected the next refresh at %s, got %s", test.refresh, next.Sub(start))
+				}
+				clock.Advance(test.refresh - time.Second)
+				if token, _ = source.Token(); token != "at1" {
+					t.Errorf("expected the cached token before the refresh time, got %q", token)
+				}
+				clock.Advance(time.Second)
+				if token, _ = source.Token(); token != "at2" {
+					t.Errorf("expected a new token at the refresh time, got %q", token)
+				}
+			},
+		)
+	}
+}
+
+func TestAccessTokenSourceRefreshLoop(t *testing.T) {
+	start := time.Now()
+	clock := NewFakeClock(start)
+	var issued atomic.Int32
+	server := newTestMytokenServer(t, accessTokenHandler(600, &issued), nil, WithClock(clock))
+	source := NewAccessTokenSource(server.AccessToken, "mytoken", "", nil, nil, "")
+
+	type update struct {
+		token string
+		at    time.Time
+	}
+	updates := make(chan update)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		source.refreshLoop(
+			ctx, func(token string, _ time.Time) error {
+				updates <- update{token: token, at: clock.Now()}
+				return nil
+			}, nil,
+		)
+	}()
+	next := func() update {
+		select {
+		case u := <-updates:
+			return u
+		case <-time.After(5 * time.Second):
+			t.Fatal("no token update")
+		}
+		return update{}
+	}
+
+	if u := next(); u.token != "at1" || !u.at.Equal(start) {
+		t.Fatalf("expected the first token immediately, got %q after %s", u.token, u.at.Sub(start))
+	}
+	clock.BlockUntilWaiters(1)
+	clock.Advance(9*time.Minute - time.Second)
+	select {
+	case u := <-updates:
+		t.Fatalf("unexpected refresh to %q before the refresh time", u.token)
+	case <-time.After(50 * time.Millisecond):
+	}
+	clock.Advance(time.Second)
+	if u := next(); u.token != "at2" || !u.at.Equal(start.Add(9*time.Minute)) {
+		t.Fatalf("expected a refresh after 9m, got %q after %s", u.token, u.at.Sub(start))
+	}
+	cancel()
+	<-done
+}
@@ -0,0 +1,348 @@
+package mytokenlib
+
+import (
+	"bytes"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// AccountConfig describes a named account, i.e. a mytoken on a mytoken server together with the defaults used when
+// requesting access tokens with it
+type AccountConfig struct {
+	// Name is the short name of the account
+	Name string `json:"name" yaml:"name"`
+	// ServerURL is the url of the mytoken server
+	ServerURL string `json:"server_url" yaml:"server_url"`
+	// Issuer is the oidc issuer of the mytoken
+	Issuer string `json:"issuer,omitempty" yaml:"issuer,omitempty"`
+	// TokenLocation specifies where the mytoken is loaded from, in the format understood by ParseMytokenSource. If
+	// the mytoken is rotated, the new mytoken is written back if the mytoken was loaded from a MytokenStore, e.g. a
+	// file; otherwise it is only kept in memory.
+	TokenLocation string `json:"token_location" yaml:"token_location"`
+	// Scopes are the default scopes requested for access tokens
+	Scopes []string `json:"scopes,omitempty" yaml:"scopes,omitempty"`
+	// Audiences are the default audiences requested for access tokens
+	Audiences []string `json:"audiences,omitempty" yaml:"audiences,omitempty"`
+}
+
+// validate checks the AccountConfig; errors name the key prefixed with the account name
+func (c AccountConfig) validate(source string) error {
+	key := func(k string) string {
+		return "accounts." + c.Name + "." + k
+	}
+	if c.Name == "" {
+		return ConfigError{
+			Key:     "accounts",
+			Source:  source,
+			Message: "account name must be set",
+		}
+	}
+	if u, err := url.Parse(c.ServerURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return ConfigError{
+			Key:     key("server_url"),
+			Source:  source,
+			Message: "must be an absolute http(s) url",
+		}
+	}
+	if _, err := ParseMytokenSource(c.TokenLocation); err != nil {
+		return ConfigError{
+			Key:     key("token_location"),
+			Source:  source,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// Accounts is a registry of named accounts. MytokenServers are created lazily when first needed and are shared
+// between accounts with the same server url; they are dropped once no account of the registry uses them anymore. It
+// is safe for concurrent use.
+type Accounts struct {
+	// ServerFactory is used to create MytokenServers; if nil, NewMytokenServer is used
+	ServerFactory func(url string) (*MytokenServer, error)
+	// OnStoreError is called with the account name if a rotated mytoken could not be written back to the account's
+	// token location
+	OnStoreError func(account string, err error)
+
+	mutex    sync.Mutex
+	configs  map[string]AccountConfig
+	accounts map[string]*Account
+	servers  map[string]*accountServer
+}
+
+// accountServer is a MytokenServer of an Accounts registry; done is closed once the creation finished
+type accountServer struct {
+	done   chan struct{}
+	server *MytokenServer
+	err    error
+}
+
+// NewAccounts creates a new Accounts registry with the passed accounts
+func NewAccounts(configs ...AccountConfig) (*Accounts, error) {
+	a := &Accounts{
+		configs:  map[string]AccountConfig{},
+		accounts: map[string]*Account{},
+		servers:  map[string]*accountServer{},
+	}
+	for _, c := range configs {
+		if err := a.Add(c); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// LoadAccounts creates a new Accounts registry from the passed YAML or JSON file. The file has a top-level key
+// "accounts" which maps account names to their configuration (see AccountConfig); the name must not be repeated in
+// the configuration.
+func LoadAccounts(path string) (*Accounts, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, newMytokenErrorFromError("could not read accounts file", err)
+	}
+	var file struct {
+		Accounts map[string]AccountConfig `yaml:"accounts"`
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err = dec.Decode(&file); err != nil {
+		return nil, newMytokenErrorFromError("could not parse accounts file", err)
+	}
+	a, err := NewAccounts()
+	if err != nil {
+		return nil, err
+	}
+	for name, c := range file.Accounts {
+		if c.Name != "" && c.Name != name {
+			return nil, ConfigError{
+				Key:     "accounts." + name + ".name",
+				Source:  path,
+				Message: "does not match the account name",
+			}
+		}
+		c.Name = name
+		if err = c.validate(path); err != nil {
+			return nil, err
+		}
+		if err = a.Add(c); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// Add adds an account to the registry; an existing account with the same name is replaced. Account handles and
+// AccessTokenSources obtained for a replaced account before are not changed, they keep using the previous
+// configuration; Get returns a handle with the new configuration.
+func (a *Accounts) Add(c AccountConfig) error {
+	if err := c.validate(""); err != nil {
+		return err
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	old, replaced := a.configs[c.Name]
+	a.configs[c.Name] = c
+	delete(a.accounts, c.Name)
+	if replaced {
+		a.evictServer(old.ServerURL)
+	}
+	return nil
+}
+
+// Remove removes the account with the passed name from the registry. Account handles and AccessTokenSources
+// obtained for the account before are not changed and can still be used.
+func (a *Accounts) Remove(name string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	old, ok := a.configs[name]
+	delete(a.configs, name)
+	delete(a.accounts, name)
+	if ok {
+		a.evictServer(old.ServerURL)
+	}
+}
+
+// evictServer removes the cached MytokenServer for the passed url if no account uses it anymore; the caller must hold
+// the registry's lock
+func (a *Accounts) evictServer(url string) {
+	for _, c := range a.configs {
+		if c.ServerURL == url {
+			return
+		}
+	}
+	delete(a.servers, url)
+}
+
+// Names returns the sorted names of all accounts
+func (a *Accounts) Names() []string {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	names := make([]string, 0, len(a.configs))
+	for n := range a.configs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns the Account with the passed name; multiple calls with the same name return the same Account
+func (a *Accounts) Get(name string) (*Account, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if acc, ok := a.accounts[name]; ok {
+		return acc, nil
+	}
+	c, ok := a.configs[name]
+	if !ok {
+		return nil, MytokenError{
+			err:          "unknown account",
+			errorDetails: name,
+		}
+	}
+	acc := &Account{
+		Config:   c,
+		registry: a,
+	}
+	a.accounts[name] = acc
+	return acc, nil
+}
+
+// server returns the MytokenServer for the passed url, creating it if needed. The server is created without holding
+// the registry's lock, since this usually requires a discovery; concurrent calls for the same url wait for the same
+// creation. A failed creation is retried by the next call.
+func (a *Accounts) server(url string) (*MytokenServer, error) {
+	a.mutex.Lock()
+	s, ok := a.servers[url]
+	if !ok {
+		s = &accountServer{done: make(chan struct{})}
+		a.servers[url] = s
+	}
+	factory := a.ServerFactory
+	a.mutex.Unlock()
+	if ok {
+		<-s.done
+		return s.server, s.err
+	}
+	if factory == nil {
+		factory = NewMytokenServer
+	}
+	s.server, s.err = factory(url)
+	if s.err != nil {
+		a.mutex.Lock()
+		// the entry might have been evicted and replaced in the meantime
+		if a.servers[url] == s {
+			delete(a.servers, url)
+		}
+		a.mutex.Unlock()
+	}
+	close(s.done)
+	return s.server, s.err
+}
+
+// Account is a handle to a named account of an Accounts registry. The mytoken is loaded when first needed and kept
+// in memory, so that rotated mytokens are used by subsequent requests; rotated mytokens are also written back to the
+// token location if possible, see AccountConfig.TokenLocation. A handle keeps the configuration it was created with,
+// also if the account is replaced or removed in the registry. It is safe for concurrent use.
+type Account struct {
+	// Config is the configuration of this account
+	Config AccountConfig
+
+	registry *Accounts
+	mutex    sync.Mutex
+	mytoken  string
+	// store is the MytokenStore the mytoken was loaded from, if any
+	store    MytokenStore
+	atSource *AccessTokenSource
+}
+
+// Server returns the MytokenServer of this account
+func (a *Account) Server() (*MytokenServer, error) {
+	return a.registry.server(a.Config.ServerURL)
+}
+
+// Mytoken returns the current mytoken of this account
+func (a *Account) Mytoken() (string, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.loadMytoken()
+}
+
+func (a *Account) loadMytoken() (string, error) {
+	if a.atSource != nil {
+		return a.atSource.Mytoken(), nil
+	}
+	if a.mytoken != "" {
+		return a.mytoken, nil
+	}
+	source, err := ParseMytokenSource(a.Config.TokenLocation)
+	if err != nil {
+		return "", err
+	}
+	var mytoken string
+	supplier := source
+	if chain, ok := source.(MytokenSourceChain); ok {
+		mytoken, supplier, err = chain.MytokenWithSource()
+	} else {
+		mytoken, err = source.Mytoken()
+	}
+	if err != nil {
+		return "", err
+	}
+	a.mytoken = mytoken
+	a.store, _ = supplier.(MytokenStore)
+	return a.mytoken, nil
+}
+
+// storeMytoken writes a rotated mytoken back to the MytokenStore it was loaded from, if any
+func (a *Account) storeMytoken(mytoken string) {
+	if a.store == nil {
+		return
+	}
+	if err := a.store.StoreMytoken(mytoken); err != nil && a.registry.OnStoreError != nil {
+		a.registry.OnStoreError(a.Config.Name, err)
+	}
+}
+
+// AccessTokenSource returns an AccessTokenSource for this account that requests access tokens with the account's
+// issuer, default scopes and audiences; multiple calls return the same AccessTokenSource. Its OnMytokenUpdate writes
+// rotated mytokens back to the token location, see AccountConfig.TokenLocation.
+func (a *Account) AccessTokenSource() (*AccessTokenSource, error) {
+	a.mutex.Lock()
+	source := a.atSource
+	a.mutex.Unlock()
+	if source != nil {
+		return source, nil
+	}
+	// the server is obtained without holding the account's lock, since its creation might require a discovery
+	server, err := a.Server()
+	if err != nil {
+		return nil, err
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.atSource != nil {
+		return a.atSource, nil
+	}
+	mytoken, err := a.loadMytoken()
+	if err != nil {
+		return nil, err
+	}
+	a.atSource = NewAccessTokenSource(
+		server.AccessToken, mytoken, a.Config.Issuer, a.Config.Scopes, a.Config.Audiences, "account "+a.Config.Name,
+	)
+	a.atSource.OnMytokenUpdate = a.storeMytoken
+	return a.atSource, nil
+}
+
+// AccessToken returns a valid access token for this account with the account's default scopes and audiences
+func (a *Account) AccessToken() (string, error) {
+	source, err := a.AccessTokenSource()
+	if err != nil {
+		return "", err
+	}
+	return source.Token()
+}
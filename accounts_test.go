@@ -0,0 +1,204 @@
+package mytokenlib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/oidc-mytoken/api/v0"
+)
+
+func TestAccountsServerCreation(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var created atomic.Int32
+	failing := map[string]bool{"https://failing.example.com": true}
+	accounts, err := NewAccounts(
+		AccountConfig{Name: "a", ServerURL: "https://mytoken.example.com", TokenLocation: "env:MYTOKEN"},
+		AccountConfig{Name: "b", ServerURL: "https://mytoken.example.com", TokenLocation: "env:MYTOKEN"},
+		AccountConfig{Name: "c", ServerURL: "https://failing.example.com", TokenLocation: "env:MYTOKEN"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts.ServerFactory = func(url string) (*MytokenServer, error) {
+		if created.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+		if failing[url] {
+			failing[url] = false
+			return nil, errors.New("discovery failed")
+		}
+		return &MytokenServer{url: url}, nil
+	}
+	a, _ := accounts.Get("a")
+	b, _ := accounts.Get("b")
+
+	servers := make([]*MytokenServer, 2)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		servers[0], _ = a.Server()
+	}()
+	<-started
+	// the registry can be used while a server is created
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		accounts.Names()
+		_, _ = accounts.Get("c")
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the registry is locked while a server is created")
+	}
+	// a concurrent call for the same url waits for the running creation
+	go func() {
+		defer wg.Done()
+		servers[1], _ = b.Server()
+	}()
+	close(release)
+	wg.Wait()
+	if servers[0] == nil || servers[0] != servers[1] {
+		t.Fatalf(
+			"expected accounts with the same server url to share the server, got %p and %p", servers[0], servers[1],
+		)
+	}
+	if n := created.Load(); n != 1 {
+		t.Fatalf("expected one server creation, got %d", n)
+	}
+
+	// a failed creation is retried
+	c, _ := accounts.Get("c")
+	if _, err = c.Server(); err == nil {
+		t.Fatal("expected the server creation to fail")
+	}
+	if server, err := c.Server(); err != nil || server == nil {
+		t.Fatalf("expected the server creation to be retried, got %v, %v", server, err)
+	}
+}
+
+func TestAccountStoresRotatedMytoken(t *testing.T) {
+	var requests atomic.Int32
+	srv := newTestServer(
+		t, func(w http.ResponseWriter, r *http.Request) {
+			var req api.AccessTokenRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			n := requests.Add(1)
+			writeJSON(
+				w, http.StatusOK, api.AccessTokenResponse{
+					AccessToken: "at",
+					ExpiresIn:   1,
+					TokenUpdate: &api.MytokenResponse{Mytoken: fmt.Sprintf("%s-rotated%d", req.Mytoken, n)},
+				},
+			)
+		}, nil,
+	)
+	t.Setenv("MYTOKEN_UNSET", "")
+	tokenFile := filepath.Join(t.TempDir(), "mytoken")
+	if err := os.WriteFile(tokenFile, []byte("mytoken\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	accounts, err := NewAccounts(
+		AccountConfig{Name: "a", ServerURL: srv.URL, TokenLocation: "env:MYTOKEN_UNSET|file:" + tokenFile},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts.OnStoreError = func(account string, err error) {
+		t.Errorf("could not store the mytoken of %s: %s", account, err)
+	}
+	account, _ := accounts.Get("a")
+	if _, err = account.AccessToken(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	data, err := os.ReadFile(tokenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "mytoken-rotated1\n" {
+		t.Errorf("expected the rotated mytoken to be written back, got %q", data)
+	}
+	if info, _ := os.Stat(tokenFile); info.Mode().Perm() != 0640 {
+		t.Errorf("expected the token file to keep its permissions, got %s", info.Mode().Perm())
+	}
+	if mytoken, _ := account.Mytoken(); mytoken != "mytoken-rotated1" {
+		t.Errorf("expected the account to use the rotated mytoken, got %q", mytoken)
+	}
+}
+
+func TestAccountsReplaceAndRemove(t *testing.T) {
+	var created atomic.Int32
+	t.Setenv("MYTOKEN", "mytoken")
+	accounts, err := NewAccounts(
+		AccountConfig{Name: "a", ServerURL: "https://old.example.com", TokenLocation: "env:MYTOKEN"},
+		AccountConfig{Name: "b", ServerURL: "https://shared.example.com", TokenLocation: "env:MYTOKEN"},
+		AccountConfig{Name: "c", ServerURL: "https://shared.example.com", TokenLocation: "env:MYTOKEN"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts.ServerFactory = func(url string) (*MytokenServer, error) {
+		created.Add(1)
+		return &MytokenServer{
+			AccessToken: newAccessTokenEndpoint(url+"/token/access", nil),
+			url:         url,
+		}, nil
+	}
+	oldHandle, _ := accounts.Get("a")
+	oldSource, err := oldHandle.AccessTokenSource()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	b, _ := accounts.Get("b")
+	if _, err = b.Server(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// a replaced account uses the new server url, the old server is evicted
+	if err = accounts.Add(
+		AccountConfig{Name: "a", ServerURL: "https://new.example.com", TokenLocation: "env:MYTOKEN"},
+	); err != nil {
+		t.Fatal(err)
+	}
+	newHandle, _ := accounts.Get("a")
+	if newHandle == oldHandle {
+		t.Fatal("expected a new handle for the replaced account")
+	}
+	if server, _ := newHandle.Server(); server.url != "https://new.example.com" {
+		t.Errorf("expected the replaced account to use the new server, got %s", server.url)
+	}
+	if _, ok := accounts.servers["https://old.example.com"]; ok {
+		t.Error("expected the server that is no longer used to be evicted")
+	}
+	// an existing handle returns its cached AccessTokenSource without creating a server again
+	n := created.Load()
+	if source, _ := oldHandle.AccessTokenSource(); source != oldSource {
+		t.Error("expected the old handle to keep its AccessTokenSource")
+	}
+	if created.Load() != n {
+		t.Error("expected the cached AccessTokenSource to be returned without obtaining the server")
+	}
+
+	// a server that is still used by another account is kept
+	accounts.Remove("b")
+	if _, ok := accounts.servers["https://shared.example.com"]; !ok {
+		t.Error("expected the server that is still used to be kept")
+	}
+	accounts.Remove("c")
+	if _, ok := accounts.servers["https://shared.example.com"]; ok {
+		t.Error("expected the server to be evicted once no account uses it")
+	}
+	if _, err = accounts.Get("c"); err == nil {
+		t.Error("expected an error for a removed account")
+	}
+}
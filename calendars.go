@@ -6,21 +6,37 @@ import (
 
 // CalendarsEndpoint is type representing a mytoken server's Calendars Endpoint
 type CalendarsEndpoint struct {
-	endpoint string
+	endpoint *lazyURL
+	client   *client
 }
 
-func newCalendarsEndpoint(endpoint string) *CalendarsEndpoint {
-	return &CalendarsEndpoint{endpoint: endpoint}
+func newCalendarsEndpoint(endpoint *lazyURL, c *client) *CalendarsEndpoint {
+	return &CalendarsEndpoint{
+		endpoint: endpoint,
+		client:   c,
+	}
 }
 
 // DoHTTPRequest performs an http request to the calendars endpoint
 func (c CalendarsEndpoint) DoHTTPRequest(method string, req, resp interface{}) error {
-	return doHTTPRequest(method, c.endpoint, req, resp)
+	return c.DoHTTPRequestWithAuth(method, req, resp, "")
 }
 
 // DoHTTPRequestWithAuth performs an http request to the calendars endpoint with mytoken authorization
 func (c CalendarsEndpoint) DoHTTPRequestWithAuth(method string, req, resp interface{}, mytoken string) error {
-	return doHTTPRequestWithAuth(method, c.endpoint, req, resp, mytoken)
+	return c.doHTTPRequestWithAuthAt("", method, req, resp, mytoken)
+}
+
+// doHTTPRequestWithAuthAt performs an http request to the passed path below the calendars endpoint with mytoken
+// authorization
+func (c CalendarsEndpoint) doHTTPRequestWithAuthAt(
+	path, method string, req, resp interface{}, mytoken string,
+) error {
+	url, err := c.endpoint.get()
+	if err != nil {
+		return err
+	}
+	return c.client.doHTTPRequestWithAuth(method, url+path, req, resp, mytoken)
 }
 
 // APIList lists all calendars
@@ -37,29 +53,25 @@ func (c CalendarsEndpoint) APICreate(mytoken string, req api.CreateCalendarReque
 
 // APIDelete deletes a calendar by ID
 func (c CalendarsEndpoint) APIDelete(mytoken, calendarID string) (resp api.OnlyTokenUpdateResponse, err error) {
-	url := c.endpoint + "/" + calendarID
-	err = doHTTPRequestWithAuth("DELETE", url, nil, &resp, mytoken)
+	err = c.doHTTPRequestWithAuthAt("/"+calendarID, "DELETE", nil, &resp, mytoken)
 	return
 }
 
 // APISubscribe subscribes a mytoken to a calendar
 func (c CalendarsEndpoint) APISubscribe(mytoken, calendarID string, req api.AddMytokenToCalendarRequest) (resp api.OnlyTokenUpdateResponse, err error) {
-	url := c.endpoint + "/" + calendarID
-	err = doHTTPRequestWithAuth("POST", url, req, &resp, mytoken)
+	err = c.doHTTPRequestWithAuthAt("/"+calendarID, "POST", req, &resp, mytoken)
 	return
 }
 
 // APIUnsubscribe unsubscribes from a calendar
 func (c CalendarsEndpoint) APIUnsubscribe(mytoken, calendarID, momID string) (resp api.OnlyTokenUpdateResponse, err error) {
-	url := c.endpoint + "/" + calendarID
 	req := api.AddMytokenToCalendarRequest{MomID: momID}
-	err = doHTTPRequestWithAuth("DELETE", url, req, &resp, mytoken)
+	err = c.doHTTPRequestWithAuthAt("/"+calendarID, "DELETE", req, &resp, mytoken)
 	return
 }
 
 // APIUpdate updates calendar description and/or tags
 func (c CalendarsEndpoint) APIUpdate(mytoken, calendarID string, req api.CreateCalendarRequest) (resp api.OnlyTokenUpdateResponse, err error) {
-	url := c.endpoint + "/" + calendarID
-	err = doHTTPRequestWithAuth("PUT", url, req, &resp, mytoken)
+	err = c.doHTTPRequestWithAuthAt("/"+calendarID, "PUT", req, &resp, mytoken)
 	return
 }
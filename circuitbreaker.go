@@ -0,0 +1,219 @@
+package mytokenlib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Defaults for the CircuitBreakerSettings
+const (
+	DefaultCircuitBreakerFailureThreshold = 5
+	DefaultCircuitBreakerOpenDuration     = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned if a request is not sent because the circuit breaker of the server is open, see
+// WithCircuitBreaker. Use errors.Is to check for it.
+var ErrCircuitOpen = MytokenError{err: "circuit breaker open"}
+
+// CircuitBreakerSettings configures the circuit breaker of a MytokenServer, see WithCircuitBreaker
+type CircuitBreakerSettings struct {
+	// FailureThreshold is the number of consecutive failed requests after which the circuit breaker opens; if 0,
+	// DefaultCircuitBreakerFailureThreshold is used
+	FailureThreshold int
+	// OpenDuration is the duration the circuit breaker stays open before it lets probe requests through; if 0,
+	// DefaultCircuitBreakerOpenDuration is used
+	OpenDuration time.Duration
+	// HalfOpenRequests is the number of concurrent probe requests in the half-open state; values smaller than 1 are
+	// treated as 1
+	HalfOpenRequests int
+}
+
+// CircuitState is the state of a circuit breaker
+type CircuitState int
+
+// CircuitStates
+const (
+	// CircuitClosed means that requests are sent normally
+	CircuitClosed CircuitState = iota
+	// CircuitOpen means that requests fail fast without being sent
+	CircuitOpen
+	// CircuitHalfOpen means that a limited number of probe requests is sent to check if the server recovered
+	CircuitHalfOpen
+)
+
+// String returns a string representation of the CircuitState
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// CircuitBreakerStatus describes the state of the circuit breaker of a MytokenServer
+type CircuitBreakerStatus struct {
+	// State is the current state
+	State CircuitState
+	// ConsecutiveFailures is the number of consecutive failed requests
+	ConsecutiveFailures int
+	// OpenedAt is the time the circuit breaker opened the last time
+	OpenedAt time.Time
+	// LastError is the error of the last failed request
+	LastError error
+}
+
+// WithCircuitBreaker enables a circuit breaker for the requests to the server. Requests fail if the server cannot be
+// reached or responds with http status 502, 503, or 504. After FailureThreshold consecutive failures the circuit
+// breaker opens and requests fail fast with an error matching ErrCircuitOpen instead of waiting for the server. After
+// OpenDuration the circuit breaker is half-open and lets probe requests through; it closes again after a successful
+// probe and opens again after a failed one.
+func WithCircuitBreaker(settings CircuitBreakerSettings) Option {
+	return func(c *client) error {
+		if settings.FailureThreshold == 0 {
+			settings.FailureThreshold = DefaultCircuitBreakerFailureThreshold
+		}
+		if settings.OpenDuration == 0 {
+			settings.OpenDuration = DefaultCircuitBreakerOpenDuration
+		}
+		if settings.HalfOpenRequests < 1 {
+			settings.HalfOpenRequests = 1
+		}
+		if settings.FailureThreshold < 0 || settings.OpenDuration < 0 {
+			return MytokenError{
+				err:          "invalid circuit breaker settings",
+				errorDetails: "values must not be negative",
+			}
+		}
+		c.breaker = &circuitBreaker{
+			settings: settings,
+			clock:    systemClock{},
+		}
+		return nil
+	}
+}
+
+// CircuitBreakerStatus returns the status of the server's circuit breaker; if no circuit breaker is configured (see
+// WithCircuitBreaker), it is always closed
+func (s *MytokenServer) CircuitBreakerStatus() CircuitBreakerStatus {
+	if s.client == nil || s.client.breaker == nil {
+		return CircuitBreakerStatus{}
+	}
+	return s.client.breaker.status()
+}
+
+// sendWithBreaker sends a request (see sendWithFailover) unless the circuit breaker is open
+func (c *client) sendWithBreaker(r request) (*http.Response, []byte, error) {
+	if c == nil || c.breaker == nil {
+		return c.sendWithFailover(r)
+	}
+	probe, err := c.breaker.allow()
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, body, err := c.sendWithFailover(r)
+	c.breaker.record(probe, resp, err)
+	return resp, body, err
+}
+
+// circuitBreaker is a circuit breaker for the requests to a mytoken server; it is safe for concurrent use
+type circuitBreaker struct {
+	settings CircuitBreakerSettings
+	clock    Clock
+
+	mutex     sync.Mutex
+	state     CircuitState
+	failures  int
+	openedAt  time.Time
+	probes    int
+	lastError error
+}
+
+func (b *circuitBreaker) status() CircuitBreakerStatus {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.update()
+	return CircuitBreakerStatus{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		OpenedAt:            b.openedAt,
+		LastError:           b.lastError,
+	}
+}
+
+// update moves an open circuit breaker to half-open once OpenDuration passed
+func (b *circuitBreaker) update() {
+	if b.state == CircuitOpen && b.clock.Now().Sub(b.openedAt) >= b.settings.OpenDuration {
+		b.state = CircuitHalfOpen
+		b.probes = 0
+	}
+}
+
+// allow checks if a request may be sent; probe tells if the request is a probe request in the half-open state
+func (b *circuitBreaker) allow() (probe bool, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.update()
+	switch b.state {
+	case CircuitOpen:
+		return false, b.openError()
+	case CircuitHalfOpen:
+		if b.probes >= b.settings.HalfOpenRequests {
+			return false, b.openError()
+		}
+		b.probes++
+		return true, nil
+	}
+	return false, nil
+}
+
+func (b *circuitBreaker) openError() error {
+	details := fmt.Sprintf("%d consecutive requests failed", b.failures)
+	if b.lastError != nil {
+		details += ", last error: " + b.lastError.Error()
+	}
+	return MytokenError{
+		err:          ErrCircuitOpen.err,
+		errorDetails: details,
+	}
+}
+
+// record records the result of a request that was allowed by allow
+func (b *circuitBreaker) record(probe bool, resp *http.Response, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if probe && b.probes > 0 {
+		b.probes--
+	}
+	if err != nil && (errors.As(err, &MytokenError{}) || errors.Is(err, context.Canceled)) {
+		// errors from the library itself, e.g. because of rate limiting, and cancelled requests say nothing about
+		// the server's health
+		return
+	}
+	failed := err != nil ||
+		(resp.StatusCode >= http.StatusBadGateway && resp.StatusCode <= http.StatusGatewayTimeout)
+	if !failed {
+		b.failures = 0
+		b.state = CircuitClosed
+		return
+	}
+	b.failures++
+	b.lastError = err
+	if err == nil {
+		b.lastError = MytokenError{
+			err:          errSendingHttpRequest,
+			errorDetails: resp.Status,
+		}
+	}
+	if probe || b.failures >= b.settings.FailureThreshold {
+		b.state = CircuitOpen
+		b.openedAt = b.clock.Now()
+	}
+}
@@ -0,0 +1,80 @@
+package mytokenlib
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/oidc-mytoken/api/v0"
+)
+
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	var failing atomic.Bool
+	var requests atomic.Int32
+	server := newTestMytokenServer(
+		t, func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			if failing.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			writeJSON(w, http.StatusOK, api.AccessTokenResponse{AccessToken: "at"})
+		}, nil,
+		WithClock(clock), WithRetryPolicy(RetryPolicy{MaxAttempts: 1}),
+		WithCircuitBreaker(CircuitBreakerSettings{FailureThreshold: 2, OpenDuration: 30 * time.Second}),
+	)
+	get := func() error {
+		_, err := server.AccessToken.APIGet("mytoken", "", nil, nil, "")
+		return err
+	}
+
+	failing.Store(true)
+	for i := 0; i < 2; i++ {
+		if err := get(); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("expected the request to fail at the server, got: %v", err)
+		}
+	}
+	if s := server.CircuitBreakerStatus(); s.State != CircuitOpen || s.ConsecutiveFailures != 2 {
+		t.Fatalf(
+			"expected the circuit breaker to be open after 2 failures, got %s with %d failures", s.State,
+			s.ConsecutiveFailures,
+		)
+	}
+	if err := get(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected an error matching ErrCircuitOpen, got: %v", err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Fatalf("expected no request while the circuit breaker is open, got %d requests", n)
+	}
+
+	clock.Advance(30*time.Second - time.Millisecond)
+	if s := server.CircuitBreakerStatus(); s.State != CircuitOpen {
+		t.Fatalf("expected the circuit breaker to stay open before the open duration passed, got %s", s.State)
+	}
+	clock.Advance(time.Millisecond)
+	if s := server.CircuitBreakerStatus(); s.State != CircuitHalfOpen {
+		t.Fatalf("expected the circuit breaker to be half-open after the open duration, got %s", s.State)
+	}
+	// a failed probe opens the circuit breaker again
+	if err := get(); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected the probe to fail at the server, got: %v", err)
+	}
+	if s := server.CircuitBreakerStatus(); s.State != CircuitOpen {
+		t.Fatalf("expected the circuit breaker to open after a failed probe, got %s", s.State)
+	}
+
+	failing.Store(false)
+	clock.Advance(30 * time.Second)
+	if err := get(); err != nil {
+		t.Fatalf("expected the probe to succeed, got: %v", err)
+	}
+	if s := server.CircuitBreakerStatus(); s.State != CircuitClosed || s.ConsecutiveFailures != 0 {
+		t.Fatalf(
+			"expected the circuit breaker to close after a successful probe, got %s with %d failures", s.State,
+			s.ConsecutiveFailures,
+		)
+	}
+}
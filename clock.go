@@ -0,0 +1,257 @@
+package mytokenlib
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// Clock is the source of the current time and of timers used by a MytokenServer, e.g. for polling, token expiry, and
+// caches; see WithClock. The default clock uses the time package; FakeClock is a controllable clock for tests.
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+	// NewTimer creates a Timer that fires once after the passed duration, like time.NewTimer
+	NewTimer(d time.Duration) Timer
+	// NewTicker creates a Ticker that fires in the passed interval, like time.NewTicker
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is a timer created by a Clock, see time.Timer
+type Timer interface {
+	// C returns the channel on which the time is delivered when the timer fires
+	C() <-chan time.Time
+	// Stop stops the timer; it returns false if the timer already fired or was stopped
+	Stop() bool
+}
+
+// Ticker is a ticker created by a Clock, see time.Ticker
+type Ticker interface {
+	// C returns the channel on which the ticks are delivered
+	C() <-chan time.Time
+	// Stop stops the ticker
+	Stop()
+}
+
+// WithClock sets the Clock used by the MytokenServer and the types that use it, e.g. AccessTokenSource, FileSink,
+// and CredmonProducer. It is used for polling, backoffs, expiry calculations, and caches, and as the local clock
+// the ClockSkew is estimated against; the timeout of the http requests (see WithTimeout) is not affected.
+func WithClock(clock Clock) Option {
+	return func(c *client) error {
+		c.clock = clock
+		return nil
+	}
+}
+
+func (c *client) getClock() Clock {
+	if c != nil && c.clock != nil {
+		return c.clock
+	}
+	return systemClock{}
+}
+
+// sleep waits for the passed duration on the client's Clock; false is returned if the client's context is done
+// before
+func (c *client) sleep(d time.Duration) bool {
+	timer := c.getClock().NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-c.getContext().Done():
+		return false
+	case <-timer.C():
+		return true
+	}
+}
+
+// systemClock is the Clock based on the time package
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type systemTimer struct {
+	*time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// FakeClock is a Clock for tests whose time only changes when it is advanced with Advance or Set; timers and tickers
+// fire when the time passes their deadline. It is safe for concurrent use.
+type FakeClock struct {
+	mutex   sync.Mutex
+	changed *sync.Cond
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+// NewFakeClock creates a new FakeClock that starts at the passed time
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{now: now}
+	c.changed = sync.NewCond(&c.mutex)
+	return c
+}
+
+// Now returns the current time of the FakeClock
+func (c *FakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// Advance advances the time of the FakeClock by the passed duration and fires the timers and tickers that are due
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.setLocked(c.now.Add(d))
+}
+
+// Set sets the time of the FakeClock and fires the timers and tickers that are due; setting an earlier time does not
+// fire anything
+func (c *FakeClock) Set(now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.setLocked(now)
+}
+
+// Waiters returns the number of active timers and tickers
+func (c *FakeClock) Waiters() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.waiters)
+}
+
+// BlockUntilWaiters blocks until at least n timers and tickers are active, e.g. to wait until code under test that
+// runs in another goroutine waits on the FakeClock before advancing it
+func (c *FakeClock) BlockUntilWaiters(n int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for len(c.waiters) < n {
+		c.changed.Wait()
+	}
+}
+
+// NewTimer creates a Timer that fires once the time of the FakeClock advanced by the passed duration
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	return fakeTimer{c.addWaiter(d, 0)}
+}
+
+// NewTicker creates a Ticker that fires each time the time of the FakeClock advanced by the passed interval; like
+// time.Ticker, it drops ticks if they are not received
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for FakeClock.NewTicker")
+	}
+	return fakeTicker{c.addWaiter(d, d)}
+}
+
+func (c *FakeClock) addWaiter(d, period time.Duration) *fakeWaiter {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	w := &fakeWaiter{
+		clock:    c,
+		deadline: c.now.Add(d),
+		period:   period,
+		ch:       make(chan time.Time, 1),
+	}
+	c.waiters = append(c.waiters, w)
+	c.fireLocked()
+	c.changed.Broadcast()
+	return w
+}
+
+func (c *FakeClock) removeLocked(w *fakeWaiter) bool {
+	i := slices.Index(c.waiters, w)
+	if i < 0 {
+		return false
+	}
+	c.waiters = slices.Delete(c.waiters, i, i+1)
+	c.changed.Broadcast()
+	return true
+}
+
+func (c *FakeClock) setLocked(now time.Time) {
+	if now.After(c.now) {
+		c.now = now
+	}
+	c.fireLocked()
+}
+
+// fireLocked fires the timers and tickers that are due in the order of their deadlines
+func (c *FakeClock) fireLocked() {
+	for {
+		var next *fakeWaiter
+		for _, w := range c.waiters {
+			if !w.deadline.After(c.now) && (next == nil || w.deadline.Before(next.deadline)) {
+				next = w
+			}
+		}
+		if next == nil {
+			return
+		}
+		select {
+		case next.ch <- next.deadline:
+		default:
+		}
+		if next.period == 0 {
+			c.removeLocked(next)
+			continue
+		}
+		for !next.deadline.After(c.now) {
+			next.deadline = next.deadline.Add(next.period)
+		}
+	}
+}
+
+// fakeWaiter is the state of a Timer or Ticker of a FakeClock
+type fakeWaiter struct {
+	clock    *FakeClock
+	deadline time.Time
+	// period is the interval of a ticker, 0 for a timer
+	period time.Duration
+	ch     chan time.Time
+}
+
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.ch
+}
+
+func (w *fakeWaiter) stop() bool {
+	w.clock.mutex.Lock()
+	defer w.clock.mutex.Unlock()
+	return w.clock.removeLocked(w)
+}
+
+type fakeTimer struct {
+	*fakeWaiter
+}
+
+func (t fakeTimer) Stop() bool {
+	return t.stop()
+}
+
+type fakeTicker struct {
+	*fakeWaiter
+}
+
+func (t fakeTicker) Stop() {
+	t.stop()
+}
@@ -0,0 +1,192 @@
+package mytokenlib
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/oidc-mytoken/api/v0"
+)
+
+// DefaultClockSkewWarningThreshold is the clock skew above which a warning is logged if no other threshold is set
+// with WithClockSkewWarningThreshold
+const DefaultClockSkewWarningThreshold = time.Minute
+
+// clockSkewWeight is the weight of a new sample in the clock skew estimate
+const clockSkewWeight = 0.25
+
+// WithClockSkewWarningThreshold sets the clock skew between the local clock and the server's clock above which a
+// warning is logged (see WithLogger); a negative threshold disables the warning. By default,
+// DefaultClockSkewWarningThreshold is used.
+func WithClockSkewWarningThreshold(threshold time.Duration) Option {
+	return func(c *client) error {
+		c.clockSkewWarningThreshold = threshold
+		return nil
+	}
+}
+
+// ClockSkew returns the estimated offset of the server's clock to the local clock, i.e. a positive skew means that
+// the server's clock is ahead. The skew is estimated from the Date headers of the server's responses; false is
+// returned if no response with a Date header was received yet. Since the Date header has a resolution of one second,
+// the estimate is only accurate to about half a second.
+func (s *MytokenServer) ClockSkew() (time.Duration, bool) {
+	if s.client == nil || s.client.clockSkew == nil {
+		return 0, false
+	}
+	return s.client.clockSkew.get()
+}
+
+// Now returns the current time according to the server's clock, i.e. the local time corrected by the ClockSkew
+func (s *MytokenServer) Now() time.Time {
+	return s.ServerTime(s.client.getClock().Now())
+}
+
+// ServerTime converts the passed local time into the corresponding time of the server's clock, see ClockSkew. Use it
+// for absolute times that are sent to the server in own requests (see Endpoint.DoHTTPRequest); the nbf and exp claims
+// of the restrictions passed to the api methods, e.g. MytokenEndpoint.APIFromMytoken, are converted automatically.
+func (s *MytokenServer) ServerTime(local time.Time) time.Time {
+	skew, _ := s.ClockSkew()
+	return local.Add(skew)
+}
+
+// LocalTime converts the passed time of the server's clock into the corresponding local time, see ClockSkew. Use it
+// for absolute times returned by the server, e.g. the expiration of a mytoken.
+func (s *MytokenServer) LocalTime(server time.Time) time.Time {
+	skew, _ := s.ClockSkew()
+	return server.Add(-skew)
+}
+
+// TimeRestriction returns an api.Restriction that is valid between the passed local times. Like all restrictions
+// passed to the api methods, it is converted to the server's clock (see ServerTime) when it is sent, so that it is
+// valid at the intended times even if the clocks differ. A zero time leaves the respective claim unset.
+func (s *MytokenServer) TimeRestriction(notBefore, expiresAt time.Time) *api.Restriction {
+	r := &api.Restriction{}
+	if !notBefore.IsZero() {
+		r.NotBefore = notBefore.Unix()
+	}
+	if !expiresAt.IsZero() {
+		r.ExpiresAt = expiresAt.Unix()
+	}
+	return r
+}
+
+// getClockSkew returns the estimated clock skew of the server, or 0 if it is not known
+func (c *client) getClockSkew() time.Duration {
+	if c == nil || c.clockSkew == nil {
+		return 0
+	}
+	skew, _ := c.clockSkew.get()
+	return skew
+}
+
+// serverTimeRestrictions returns the passed api.Restrictions with their nbf and exp claims, which are local times,
+// converted to the server's clock (see MytokenServer.ServerTime); the passed restrictions are not modified
+func (c *client) serverTimeRestrictions(restrictions api.Restrictions) api.Restrictions {
+	skew := int64(c.getClockSkew().Round(time.Second) / time.Second)
+	if skew == 0 {
+		return restrictions
+	}
+	converted := make(api.Restrictions, len(restrictions))
+	for i, r := range restrictions {
+		if r == nil || (r.NotBefore == 0 && r.ExpiresAt == 0) {
+			converted[i] = r
+			continue
+		}
+		serverTime := *r
+		if serverTime.NotBefore != 0 {
+			serverTime.NotBefore += skew
+		}
+		if serverTime.ExpiresAt != 0 {
+			serverTime.ExpiresAt += skew
+		}
+		converted[i] = &serverTime
+	}
+	return converted
+}
+
+// serverTimeRequest returns the passed mytoken request with the restrictions converted to the server's clock (see
+// serverTimeRestrictions) if it is an api.GeneralMytokenRequest or an api.MytokenFromMytokenRequest; for pointers a
+// converted copy is returned. Other requests are returned unmodified.
+func (c *client) serverTimeRequest(request interface{}) interface{} {
+	switch req := request.(type) {
+	case api.GeneralMytokenRequest:
+		req.Restrictions = c.serverTimeRestrictions(req.Restrictions)
+		return req
+	case *api.GeneralMytokenRequest:
+		if req == nil {
+			return request
+		}
+		converted := *req
+		converted.Restrictions = c.serverTimeRestrictions(req.Restrictions)
+		return &converted
+	case api.MytokenFromMytokenRequest:
+		req.Restrictions = c.serverTimeRestrictions(req.Restrictions)
+		return req
+	case *api.MytokenFromMytokenRequest:
+		if req == nil {
+			return request
+		}
+		converted := *req
+		converted.Restrictions = c.serverTimeRestrictions(req.Restrictions)
+		return &converted
+	}
+	return request
+}
+
+// observeClockSkew updates the clock skew estimate from the Date header of the passed response to a request that was
+// sent at start and answered at end, and warns if the skew exceeds the threshold
+func (c *client) observeClockSkew(resp *http.Response, start, end time.Time) {
+	if c == nil || c.clockSkew == nil {
+		return
+	}
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return
+	}
+	// the Date header is truncated to seconds and was generated somewhere between sending the request and receiving
+	// the response
+	sample := date.Add(500 * time.Millisecond).Sub(start.Add(end.Sub(start) / 2))
+	threshold := c.clockSkewWarningThreshold
+	if threshold == 0 {
+		threshold = DefaultClockSkewWarningThreshold
+	}
+	skew, warn := c.clockSkew.observe(sample, threshold)
+	if warn {
+		c.log(
+			slog.LevelWarn, "the local clock differs from the mytoken server's clock", "server", c.serverURL,
+			"skew", skew.Round(time.Second), "threshold", threshold,
+		)
+	}
+}
+
+// clockSkewEstimate is an estimate of the clock skew of a server; it is safe for concurrent use
+type clockSkewEstimate struct {
+	mutex  sync.Mutex
+	skew   time.Duration
+	known  bool
+	warned bool
+}
+
+func (e *clockSkewEstimate) get() (time.Duration, bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.skew, e.known
+}
+
+// observe adds a sample to the estimate; warn tells if the skew just exceeded the passed threshold, so that it is only
+// reported once until the skew is below the threshold again. A negative threshold disables the warning.
+func (e *clockSkewEstimate) observe(sample, threshold time.Duration) (skew time.Duration, warn bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.known {
+		e.skew += time.Duration(float64(sample-e.skew) * clockSkewWeight)
+	} else {
+		e.skew = sample
+		e.known = true
+	}
+	exceeded := threshold >= 0 && (e.skew > threshold || e.skew < -threshold)
+	warn = exceeded && !e.warned
+	e.warned = exceeded
+	return e.skew, warn
+}
@@ -0,0 +1,131 @@
+package mytokenlib
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/oidc-mytoken/api/v0"
+)
+
+func TestRestrictionsAreConvertedToServerTime(t *testing.T) {
+	var received api.MytokenFromMytokenRequest
+	server := newTestMytokenServer(
+		t, func(w http.ResponseWriter, r *http.Request) {
+			_ = json.NewDecoder(r.Body).Decode(&received)
+			writeJSON(w, http.StatusOK, api.MytokenResponse{Mytoken: "sub-mytoken"})
+		}, nil,
+	)
+	// the server's clock is an hour ahead
+	server.client.clockSkew = &clockSkewEstimate{}
+	server.client.clockSkew.observe(time.Hour, -1)
+
+	now := time.Now()
+	restrictions := api.Restrictions{
+		server.TimeRestriction(now, now.Add(time.Hour)),
+		{Scope: "openid"},
+	}
+	if _, err := server.Mytoken.APIFromMytoken(
+		"mytoken", "", restrictions, nil, nil, "", "",
+	); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(received.Restrictions) != 2 {
+		t.Fatalf("expected two restrictions, got %d", len(received.Restrictions))
+	}
+	if nbf := received.Restrictions[0].NotBefore; nbf != now.Add(time.Hour).Unix() {
+		t.Errorf("expected nbf to be converted to %d, got %d", now.Add(time.Hour).Unix(), nbf)
+	}
+	if exp := received.Restrictions[0].ExpiresAt; exp != now.Add(2*time.Hour).Unix() {
+		t.Errorf("expected exp to be converted to %d, got %d", now.Add(2*time.Hour).Unix(), exp)
+	}
+	if received.Restrictions[1].NotBefore != 0 || received.Restrictions[1].ExpiresAt != 0 {
+		t.Errorf("expected a restriction without times to stay without times, got %+v", received.Restrictions[1])
+	}
+	if restrictions[0].NotBefore != now.Unix() || restrictions[0].ExpiresAt != now.Add(time.Hour).Unix() {
+		t.Errorf("expected the passed restrictions not to be modified, got %+v", restrictions[0])
+	}
+}
+
+func TestAPIFromRequestConvertsRestrictionsToServerTime(t *testing.T) {
+	var received api.MytokenFromMytokenRequest
+	server := newTestMytokenServer(
+		t, func(w http.ResponseWriter, r *http.Request) {
+			received = api.MytokenFromMytokenRequest{}
+			_ = json.NewDecoder(r.Body).Decode(&received)
+			writeJSON(w, http.StatusOK, api.MytokenResponse{Mytoken: "sub-mytoken"})
+		}, nil,
+	)
+	now := time.Now()
+	restrictions := func() api.Restrictions {
+		return api.Restrictions{server.TimeRestriction(now, now.Add(time.Hour))}
+	}
+	general := api.GeneralMytokenRequest{
+		GrantType:    api.GrantTypeMytoken,
+		Restrictions: restrictions(),
+	}
+	fromMytoken := api.MytokenFromMytokenRequest{
+		GeneralMytokenRequest: general,
+		Mytoken:               "mytoken",
+	}
+	fromMytoken.Restrictions = restrictions()
+	tests := []struct {
+		name      string
+		request   any
+		converted bool
+	}{
+		{
+			name:      "general request",
+			request:   general,
+			converted: true,
+		},
+		{
+			name:      "pointer to general request",
+			request:   &general,
+			converted: true,
+		},
+		{
+			name:      "mytoken request",
+			request:   fromMytoken,
+			converted: true,
+		},
+		{
+			name:      "pointer to mytoken request",
+			request:   &fromMytoken,
+			converted: true,
+		},
+		{
+			name: "raw request",
+			request: map[string]any{
+				"grant_type":   api.GrantTypeMytoken,
+				"restrictions": restrictions(),
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				// the server's clock is an hour ahead; the estimate is reset since the responses update it
+				server.client.clockSkew = &clockSkewEstimate{}
+				server.client.clockSkew.observe(time.Hour, -1)
+				if _, err := server.Mytoken.APIFromRequest(test.request); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if len(received.Restrictions) != 1 {
+					t.Fatalf("expected one restriction, got %d", len(received.Restrictions))
+				}
+				expectedNotBefore := now.Unix()
+				if test.converted {
+					expectedNotBefore = now.Add(time.Hour).Unix()
+				}
+				if nbf := received.Restrictions[0].NotBefore; nbf != expectedNotBefore {
+					t.Errorf("expected nbf %d, got %d", expectedNotBefore, nbf)
+				}
+			},
+		)
+	}
+	if general.Restrictions[0].NotBefore != now.Unix() || fromMytoken.Restrictions[0].NotBefore != now.Unix() {
+		t.Error("expected the passed requests not to be modified")
+	}
+}
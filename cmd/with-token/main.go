@@ -0,0 +1,115 @@
+// Command with-token runs a command with a fresh access token obtained from a mytoken server in its environment.
+//
+// Usage:
+//
+//	with-token [flags] -- command [args...]
+//
+// The mytoken is read from the source passed with -mytoken (see mytokenlib.ParseMytokenSource); by default it is
+// taken from the MYTOKEN environment variable, the file named by MYTOKEN_FILE, or the systemd credential "mytoken".
+// If the mytoken server rotates the mytoken, the new mytoken is written back to the file it was read from.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/oidc-mytoken/lib"
+)
+
+func main() {
+	server := flag.String("server", os.Getenv("MYTOKEN_SERVER"), "url of the mytoken server")
+	mytokenSpec := flag.String("mytoken", "", "source to read the mytoken from, e.g. 'file:<path>' or 'env:<VAR>'")
+	issuer := flag.String("issuer", "", "oidc issuer of the mytoken")
+	scopes := flag.String("scope", "", "space separated scopes to request")
+	audiences := flag.String("audience", "", "space separated audiences to request")
+	comment := flag.String("comment", "with-token", "comment stating the usage of the access token")
+	envVars := flag.String(
+		"env", strings.Join(mytokenlib.DefaultAccessTokenEnvVars, ","),
+		"comma separated environment variables to export the access token as",
+	)
+	tokenFile := flag.String(
+		"token-file", "", "file to write the access token to and to refresh it in while the command runs",
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] -- command [args...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 || *server == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var mytokenSource mytokenlib.MytokenSource = mytokenlib.DefaultMytokenSources()
+	if *mytokenSpec != "" {
+		var err error
+		if mytokenSource, err = mytokenlib.ParseMytokenSource(*mytokenSpec); err != nil {
+			fail(err)
+		}
+	}
+	mytoken, supplier, err := readMytoken(mytokenSource)
+	if err != nil {
+		fail(err)
+	}
+
+	mytokenServer, err := mytokenlib.NewMytokenServer(*server)
+	if err != nil {
+		fail(err)
+	}
+	source := mytokenlib.NewAccessTokenSource(
+		mytokenServer.AccessToken, mytoken, *issuer, strings.Fields(*scopes), strings.Fields(*audiences), *comment,
+	)
+	source.OnMytokenUpdate = func(mytoken string) {
+		store, ok := supplier.(mytokenlib.MytokenStore)
+		if !ok {
+			fmt.Fprintf(
+				os.Stderr, "with-token: the mytoken was rotated, but the new mytoken cannot be stored in %s\n",
+				supplier.Name(),
+			)
+			return
+		}
+		if err := store.StoreMytoken(mytoken); err != nil {
+			fmt.Fprintf(os.Stderr, "with-token: could not store rotated mytoken: %s\n", err)
+		}
+	}
+	config := mytokenlib.RunConfig{
+		EnvVars:   splitList(*envVars),
+		TokenFile: *tokenFile,
+		OnRefreshError: func(err error) {
+			fmt.Fprintf(os.Stderr, "with-token: could not refresh access token: %s\n", err)
+		},
+	}
+	code, err := mytokenlib.RunWithAccessToken(source, config, flag.Arg(0), flag.Args()[1:]...)
+	if err != nil {
+		fail(err)
+	}
+	os.Exit(code)
+}
+
+// readMytoken reads the mytoken from the passed MytokenSource and returns it together with the MytokenSource that
+// supplied it, so a rotated mytoken can be written back there
+func readMytoken(source mytokenlib.MytokenSource) (string, mytokenlib.MytokenSource, error) {
+	if chain, ok := source.(mytokenlib.MytokenSourceChain); ok {
+		return chain.MytokenWithSource()
+	}
+	mytoken, err := source.Mytoken()
+	return mytoken, source, err
+}
+
+// splitList splits a comma separated list and drops empty entries
+func splitList(list string) []string {
+	var entries []string
+	for _, e := range strings.Split(list, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "with-token: %s\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,329 @@
+package mytokenlib
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigEnvPrefix is the prefix of the environment variables that override values of a Config; the variable for a
+// key is the prefix followed by the upper-cased key, e.g. MYTOKEN_SERVER_URL for server_url
+const ConfigEnvPrefix = "MYTOKEN_"
+
+// Config holds the configuration needed to bootstrap a MytokenServer and to load the mytoken used with it
+type Config struct {
+	// ServerURL is the url of the mytoken server
+	ServerURL string `json:"server_url" yaml:"server_url"`
+	// Issuer is the default oidc issuer used for access token requests, see WithDefaultIssuer
+	Issuer string `json:"issuer,omitempty" yaml:"issuer,omitempty"`
+	// TokenLocation specifies where the mytoken is loaded from, in the format understood by ParseMytokenSource
+	TokenLocation string `json:"token_location,omitempty" yaml:"token_location,omitempty"`
+	// Timeout is the timeout for a whole request, e.g. "30s"
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	// ConnectTimeout is the timeout for establishing a connection including the tls handshake, e.g. "5s"
+	ConnectTimeout string `json:"connect_timeout,omitempty" yaml:"connect_timeout,omitempty"`
+	// CABundle is the path of a file with PEM encoded CA certificates that are trusted additionally to the system
+	// certificates
+	CABundle string `json:"ca_bundle,omitempty" yaml:"ca_bundle,omitempty"`
+	// UserAgent is the user agent sent with requests
+	UserAgent string `json:"user_agent,omitempty" yaml:"user_agent,omitempty"`
+	// PinnedPublicKeys is a comma separated list of public key pins of the server's tls certificates, see
+	// WithPinnedPublicKeys
+	PinnedPublicKeys string `json:"pinned_public_keys,omitempty" yaml:"pinned_public_keys,omitempty"`
+	// ClientCertificate is the path of a PEM encoded client certificate for mutual tls authentication
+	ClientCertificate string `json:"client_certificate,omitempty" yaml:"client_certificate,omitempty"`
+	// ClientKey is the path of the PEM encoded private key of the ClientCertificate
+	ClientKey string `json:"client_key,omitempty" yaml:"client_key,omitempty"`
+	// CacheDir is the directory of a DiscoveryCache for the server's discovery documents; if empty, the discovery
+	// is not cached
+	CacheDir string `json:"cache_dir,omitempty" yaml:"cache_dir,omitempty"`
+
+	// sources holds for each set key where its value came from
+	sources map[string]string
+}
+
+// ConfigError is the error returned if a configuration is invalid; it names the offending key and where its value
+// came from
+type ConfigError struct {
+	// Key is the offending configuration key
+	Key string
+	// Source is the file or environment variable the value came from; it is empty for missing values
+	Source string
+	// Message describes the problem
+	Message string
+}
+
+// Error implements the error interface
+func (e ConfigError) Error() string {
+	if e.Source == "" {
+		return fmt.Sprintf("invalid configuration: %s: %s", e.Key, e.Message)
+	}
+	return fmt.Sprintf("invalid configuration: %s (from %s): %s", e.Key, e.Source, e.Message)
+}
+
+// LoadConfig loads a Config from the passed YAML or JSON file and applies overrides from environment variables (see
+// ConfigEnvPrefix). If path is empty, the Config is only loaded from the environment. The loaded Config is validated.
+func LoadConfig(path string) (*Config, error) {
+	c := &Config{sources: map[string]string{}}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, newMytokenErrorFromError("could not read config file", err)
+		}
+		var values map[string]interface{}
+		if err = yaml.Unmarshal(data, &values); err != nil {
+			return nil, newMytokenErrorFromError("could not parse config file", err)
+		}
+		for k, v := range values {
+			var s string
+			switch v := v.(type) {
+			case string:
+				s = v
+			case int, float64, bool:
+				s = fmt.Sprint(v)
+			default:
+				return nil, ConfigError{
+					Key:     k,
+					Source:  path,
+					Message: "must be a string",
+				}
+			}
+			if err = c.set(k, s, path); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, k := range configKeys() {
+		env := ConfigEnvPrefix + strings.ToUpper(k)
+		if v, ok := os.LookupEnv(env); ok {
+			if err := c.set(k, v, "environment variable "+env); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// configKeys returns all keys of a Config
+func configKeys() []string {
+	t := reflect.TypeOf(Config{})
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		if k := configKey(t.Field(i)); k != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func configKey(f reflect.StructField) string {
+	k, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+	return k
+}
+
+func (c *Config) set(key, value, source string) error {
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if configKey(v.Type().Field(i)) == key {
+			v.Field(i).SetString(value)
+			if c.sources == nil {
+				c.sources = map[string]string{}
+			}
+			c.sources[key] = source
+			return nil
+		}
+	}
+	return ConfigError{
+		Key:     key,
+		Source:  source,
+		Message: "unknown key",
+	}
+}
+
+func (c *Config) errorFor(key, msg string) ConfigError {
+	return ConfigError{
+		Key:     key,
+		Source:  c.sources[key],
+		Message: msg,
+	}
+}
+
+// Validate checks the Config and returns a ConfigError for the first invalid value
+func (c *Config) Validate() error {
+	if c.ServerURL == "" {
+		return c.errorFor("server_url", "must be set")
+	}
+	if u, err := url.Parse(c.ServerURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return c.errorFor("server_url", "must be an absolute http(s) url")
+	}
+	if c.Issuer != "" {
+		if u, err := url.Parse(c.Issuer); err != nil || u.Scheme == "" || u.Host == "" {
+			return c.errorFor("issuer", "must be an absolute url")
+		}
+	}
+	if c.TokenLocation != "" {
+		if _, err := ParseMytokenSource(c.TokenLocation); err != nil {
+			return c.errorFor("token_location", err.Error())
+		}
+	}
+	for _, k := range []string{"timeout", "connect_timeout"} {
+		if _, err := c.duration(k); err != nil {
+			return c.errorFor(k, err.Error())
+		}
+	}
+	if c.ClientCertificate != "" && c.ClientKey == "" {
+		return c.errorFor("client_key", "must be set if client_certificate is set")
+	}
+	if c.ClientKey != "" && c.ClientCertificate == "" {
+		return c.errorFor("client_certificate", "must be set if client_key is set")
+	}
+	for _, o := range c.tlsOptions() {
+		if err := o.option(&client{}); err != nil {
+			return c.errorFor(o.key, err.Error())
+		}
+	}
+	return nil
+}
+
+// duration parses the duration of the passed key; plain numbers are interpreted as seconds
+func (c *Config) duration(key string) (time.Duration, error) {
+	var s string
+	switch key {
+	case "timeout":
+		s = c.Timeout
+	case "connect_timeout":
+		s = c.ConnectTimeout
+	}
+	if s == "" {
+		return 0, nil
+	}
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		s = fmt.Sprintf("%gs", secs)
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("must be a duration, e.g. '30s'")
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("must not be negative")
+	}
+	return d, nil
+}
+
+// configOption is an Option together with the key of the value it was created from
+type configOption struct {
+	key    string
+	option Option
+}
+
+// tlsOptions returns the Options for the configured tls settings
+func (c *Config) tlsOptions() []configOption {
+	var opts []configOption
+	if c.CABundle != "" {
+		opts = append(opts, configOption{"ca_bundle", WithCABundle(c.CABundle)})
+	}
+	if c.PinnedPublicKeys != "" {
+		pins := strings.FieldsFunc(
+			c.PinnedPublicKeys, func(r rune) bool {
+				return r == ',' || r == ' '
+			},
+		)
+		opts = append(opts, configOption{"pinned_public_keys", WithPinnedPublicKeys(pins...)})
+	}
+	if c.ClientCertificate != "" && c.ClientKey != "" {
+		opts = append(
+			opts, configOption{"client_certificate", WithClientCertificate(c.ClientCertificate, c.ClientKey)},
+		)
+	}
+	return opts
+}
+
+// options returns the Options for a MytokenServer as configured
+func (c *Config) options() ([]Option, error) {
+	timeout, err := c.duration("timeout")
+	if err != nil {
+		return nil, c.errorFor("timeout", err.Error())
+	}
+	connectTimeout, err := c.duration("connect_timeout")
+	if err != nil {
+		return nil, c.errorFor("connect_timeout", err.Error())
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if connectTimeout > 0 {
+		transport.DialContext = (&net.Dialer{Timeout: connectTimeout}).DialContext
+		transport.TLSHandshakeTimeout = connectTimeout
+	}
+	opts := []Option{
+		WithHTTPClient(&http.Client{Transport: transport}),
+		WithTimeout(timeout),
+	}
+	for _, o := range c.tlsOptions() {
+		opts = append(opts, o.option)
+	}
+	if c.Issuer != "" {
+		opts = append(opts, WithDefaultIssuer(c.Issuer))
+	}
+	if c.UserAgent != "" {
+		opts = append(opts, WithUserAgent(c.UserAgent))
+	}
+	if c.CacheDir != "" {
+		opts = append(opts, WithDiscoveryCacheDir(c.CacheDir))
+	}
+	return opts, nil
+}
+
+// NewMytokenServer creates a new MytokenServer as configured by this Config; additional options can be passed
+func (c *Config) NewMytokenServer(opts ...Option) (*MytokenServer, error) {
+	configOpts, err := c.options()
+	if err != nil {
+		return nil, err
+	}
+	return NewMytokenServerWithOptions(c.ServerURL, append(configOpts, opts...)...)
+}
+
+// Mytoken loads the mytoken from the configured token location; if no token location is configured,
+// DefaultMytokenSources are used. Additionally, the name of the MytokenSource that supplied the mytoken is returned.
+func (c *Config) Mytoken() (string, string, error) {
+	var source MytokenSource = DefaultMytokenSources()
+	if c.TokenLocation != "" {
+		var err error
+		if source, err = ParseMytokenSource(c.TokenLocation); err != nil {
+			return "", "", c.errorFor("token_location", err.Error())
+		}
+	}
+	if chain, ok := source.(MytokenSourceChain); ok {
+		t, s, err := chain.MytokenWithSource()
+		if err != nil {
+			return "", "", err
+		}
+		return t, s.Name(), nil
+	}
+	t, err := source.Mytoken()
+	return t, source.Name(), err
+}
+
+// NewMytokenServerFromConfig loads a Config from the passed file and the environment (see LoadConfig), creates the
+// configured MytokenServer and loads the mytoken. The loaded Config is also returned, e.g. to access the configured
+// values.
+func NewMytokenServerFromConfig(path string) (server *MytokenServer, mytoken string, config *Config, err error) {
+	config, err = LoadConfig(path)
+	if err != nil {
+		return
+	}
+	if mytoken, _, err = config.Mytoken(); err != nil {
+		return
+	}
+	server, err = config.NewMytokenServer()
+	return
+}
@@ -0,0 +1,237 @@
+package mytokenlib
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oidc-mytoken/api/v0"
+)
+
+// writeConfigFile writes the passed content to a config file with the passed name in a temporary directory
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// clearConfigEnv unsets all environment variables that override config values for the duration of the test
+func clearConfigEnv(t *testing.T) {
+	t.Helper()
+	for _, k := range configKeys() {
+		env := ConfigEnvPrefix + strings.ToUpper(k)
+		if v, ok := os.LookupEnv(env); ok {
+			t.Setenv(env, v)
+			_ = os.Unsetenv(env)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		content  string
+		env      map[string]string
+		expected Config
+	}{
+		{
+			name: "yaml",
+			file: "config.yaml",
+			content: "server_url: https://mytoken.example.com\n" +
+				"issuer: https://op.example.com\n" +
+				"timeout: 30\n" +
+				"connect_timeout: 5s\n",
+			expected: Config{
+				ServerURL:      "https://mytoken.example.com",
+				Issuer:         "https://op.example.com",
+				Timeout:        "30",
+				ConnectTimeout: "5s",
+			},
+		},
+		{
+			name:    "json",
+			file:    "config.json",
+			content: `{"server_url": "https://mytoken.example.com", "token_location": "env:TOKEN", "timeout": 1.5}`,
+			expected: Config{
+				ServerURL:     "https://mytoken.example.com",
+				TokenLocation: "env:TOKEN",
+				Timeout:       "1.5",
+			},
+		},
+		{
+			name:    "environment overrides file",
+			file:    "config.yaml",
+			content: "server_url: https://mytoken.example.com\nuser_agent: file-agent\n",
+			env: map[string]string{
+				"MYTOKEN_USER_AGENT": "env-agent",
+				"MYTOKEN_ISSUER":     "https://op.example.com",
+			},
+			expected: Config{
+				ServerURL: "https://mytoken.example.com",
+				Issuer:    "https://op.example.com",
+				UserAgent: "env-agent",
+			},
+		},
+		{
+			name: "environment only",
+			env: map[string]string{
+				"MYTOKEN_SERVER_URL": "https://mytoken.example.com",
+			},
+			expected: Config{
+				ServerURL: "https://mytoken.example.com",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				clearConfigEnv(t)
+				for k, v := range test.env {
+					t.Setenv(k, v)
+				}
+				path := ""
+				if test.file != "" {
+					path = writeConfigFile(t, test.file, test.content)
+				}
+				config, err := LoadConfig(path)
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				config.sources = nil
+				if !reflect.DeepEqual(*config, test.expected) {
+					t.Errorf("expected %+v, got %+v", test.expected, *config)
+				}
+			},
+		)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		env     map[string]string
+		// expected is the expected ConfigError; a Source of "file" stands for the path of the config file
+		expected ConfigError
+	}{
+		{
+			name:     "missing server url",
+			content:  "issuer: https://op.example.com\n",
+			expected: ConfigError{Key: "server_url"},
+		},
+		{
+			name:     "unknown key",
+			content:  "server_url: https://mytoken.example.com\nserver: x\n",
+			expected: ConfigError{Key: "server", Source: "file"},
+		},
+		{
+			name:     "non-string value",
+			content:  "server_url: https://mytoken.example.com\ntimeout: [1, 2]\n",
+			expected: ConfigError{Key: "timeout", Source: "file"},
+		},
+		{
+			name:     "invalid value from file",
+			content:  "server_url: https://mytoken.example.com\nissuer: op.example.com\n",
+			expected: ConfigError{Key: "issuer", Source: "file"},
+		},
+		{
+			name:     "invalid value from environment",
+			content:  "server_url: https://mytoken.example.com\n",
+			env:      map[string]string{"MYTOKEN_TIMEOUT": "soon"},
+			expected: ConfigError{Key: "timeout", Source: "environment variable MYTOKEN_TIMEOUT"},
+		},
+		{
+			name:     "environment overrides valid file value",
+			content:  "server_url: https://mytoken.example.com\n",
+			env:      map[string]string{"MYTOKEN_SERVER_URL": "mytoken.example.com"},
+			expected: ConfigError{Key: "server_url", Source: "environment variable MYTOKEN_SERVER_URL"},
+		},
+		{
+			name:     "incomplete client certificate",
+			content:  "server_url: https://mytoken.example.com\nclient_certificate: cert.pem\n",
+			expected: ConfigError{Key: "client_key"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				clearConfigEnv(t)
+				for k, v := range test.env {
+					t.Setenv(k, v)
+				}
+				path := writeConfigFile(t, "config.yaml", test.content)
+				_, err := LoadConfig(path)
+				var configErr ConfigError
+				if !errors.As(err, &configErr) {
+					t.Fatalf("expected a ConfigError, got %v", err)
+				}
+				expectedSource := test.expected.Source
+				if expectedSource == "file" {
+					expectedSource = path
+				}
+				if configErr.Key != test.expected.Key || configErr.Source != expectedSource {
+					t.Errorf(
+						"expected an error for %q from %q, got %q from %q (%s)", test.expected.Key,
+						expectedSource, configErr.Key, configErr.Source, configErr.Message,
+					)
+				}
+			},
+		)
+	}
+}
+
+func TestConfigDefaultIssuer(t *testing.T) {
+	issuers := make(chan string, 1)
+	srv := newTestServer(
+		t, func(w http.ResponseWriter, r *http.Request) {
+			var req api.AccessTokenRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			issuers <- req.Issuer
+			writeJSON(w, http.StatusOK, api.AccessTokenResponse{AccessToken: "at"})
+		}, func(metadata *api.MytokenConfiguration) {
+			metadata.ProvidersSupported = append(
+				metadata.ProvidersSupported, api.SupportedProviderConfig{Issuer: "https://other.example.com"},
+			)
+		},
+	)
+	clearConfigEnv(t)
+	t.Setenv("MYTOKEN_SERVER_URL", srv.URL)
+	t.Setenv("MYTOKEN_ISSUER", "https://op.example.com")
+	t.Setenv("MYTOKEN_TIMEOUT", "10")
+	config, err := LoadConfig("")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	server, err := config.NewMytokenServer()
+	if err != nil {
+		t.Fatalf("could not create mytoken server: %s", err)
+	}
+	if server.client.timeout != 10*time.Second {
+		t.Errorf("expected the configured timeout, got %s", server.client.timeout)
+	}
+
+	source := NewAccessTokenSource(server.AccessToken, "mytoken", "", nil, nil, "")
+	if _, err = source.Token(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if issuer := <-issuers; issuer != "https://op.example.com" {
+		t.Errorf("expected the default issuer to be sent, got %q", issuer)
+	}
+	// an explicitly passed issuer is preferred
+	if _, err = server.AccessToken.APIGet("mytoken", "https://other.example.com", nil, nil, ""); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if issuer := <-issuers; issuer != "https://other.example.com" {
+		t.Errorf("expected the passed issuer to be sent, got %q", issuer)
+	}
+}
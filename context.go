@@ -8,6 +8,7 @@ import (
 var ctx = context.Background()
 var httpClient = &http.Client{}
 var userAgent = "mytokenlib"
+var discoveryCache *DiscoveryCache
 
 // contextKey is a custom type to avoid collisions with context keys
 type contextKey string
@@ -28,3 +29,8 @@ func SetContext(contxt context.Context) {
 		userAgent = s
 	}
 }
+
+// SetDiscoveryCache sets a DiscoveryCache used for the discovery of all mytoken servers; pass nil to disable caching
+func SetDiscoveryCache(cache *DiscoveryCache) {
+	discoveryCache = cache
+}
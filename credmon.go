@@ -0,0 +1,280 @@
+package mytokenlib
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/oidc-mytoken/api/v0"
+)
+
+// File name suffixes and marker files of the HTCondor credmon credential directory layout
+const (
+	credmonTopSuffix    = ".top"
+	credmonUseSuffix    = ".use"
+	credmonMetaSuffix   = ".meta"
+	credmonMarkSuffix   = ".mark"
+	credmonCompleteFile = "CREDMON_COMPLETE"
+)
+
+// credmonTop is the content of a .top file; it holds the (sub-)mytoken from which the access tokens are obtained
+type credmonTop struct {
+	Mytoken   string   `json:"mytoken"`
+	Issuer    string   `json:"issuer,omitempty"`
+	Scopes    []string `json:"scopes,omitempty"`
+	Audiences []string `json:"audiences,omitempty"`
+	MOMID     string   `json:"mom_id,omitempty"`
+}
+
+// credmonUse is the content of a .use file; it holds the access token used by jobs
+type credmonUse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type,omitempty"`
+	ExpiresIn   int64  `json:"expires_in"`
+	ExpiresAt   int64  `json:"expires_at"`
+	Scope       string `json:"scope,omitempty"`
+}
+
+// CredmonProducer manages a HTCondor credmon-compatible credential directory from mytokens. For each user and
+// service a sub-mytoken is stored in <dir>/<user>/<service>.top and the access token obtained from it is stored and
+// refreshed in <dir>/<user>/<service>.use.
+// Credentials are removed with RemoveCredential or by placing a <service>.mark file next to the .top file, as the
+// credd does.
+type CredmonProducer struct {
+	// MinValidity is the duration an access token in a .use file must at least be valid; if it is 0,
+	// DefaultMinValidity is used. Access tokens are also refreshed once half of their lifetime has passed.
+	MinValidity time.Duration
+	// RevokeOnRemove specifies if the sub-mytoken of a credential is revoked when the credential is removed
+	RevokeOnRemove bool
+	// OnError is called with errors for single credentials that occur during Refresh or Run
+	OnError func(error)
+
+	dir    string
+	server *MytokenServer
+}
+
+// NewCredmonProducer creates a new CredmonProducer that manages the passed credential directory and uses the passed
+// MytokenServer
+func NewCredmonProducer(server *MytokenServer, dir string) *CredmonProducer {
+	return &CredmonProducer{
+		dir:    dir,
+		server: server,
+	}
+}
+
+// AddCredential creates a sub-mytoken from the passed mytoken with the passed restrictions and capabilities and
+// stores it as the credential for the passed user and service; the first access token is obtained immediately.
+// The scopes and audiences are used when requesting access tokens.
+// If the used mytoken changes (due to token rotation), the passed variable is updated accordingly.
+func (p *CredmonProducer) AddCredential(
+	user, service string, mytoken *string, issuer string, restrictions api.Restrictions,
+	capabilities api.Capabilities, scopes, audiences []string,
+) error {
+	if err := checkCredmonNames(user, service); err != nil {
+		return err
+	}
+	resp, err := p.server.Mytoken.APIFromMytoken(
+		*mytoken, issuer, restrictions, capabilities, nil, api.ResponseTypeToken, "credmon: "+user+"/"+service,
+	)
+	if err != nil {
+		return err
+	}
+	if resp.TokenUpdate != nil {
+		*mytoken = resp.TokenUpdate.Mytoken
+	}
+	top := credmonTop{
+		Mytoken:   resp.Mytoken,
+		Issuer:    issuer,
+		Scopes:    scopes,
+		Audiences: audiences,
+		MOMID:     resp.MOMID,
+	}
+	if err = os.MkdirAll(filepath.Join(p.dir, user), 0700); err != nil {
+		return err
+	}
+	if err = p.writeJSON(user, service+credmonTopSuffix, top); err != nil {
+		return err
+	}
+	return p.refreshCredential(user, service, top, true)
+}
+
+// RemoveCredential removes the credential for the passed user and service; if RevokeOnRemove is set, the
+// sub-mytoken is revoked.
+func (p *CredmonProducer) RemoveCredential(user, service string) error {
+	if err := checkCredmonNames(user, service); err != nil {
+		return err
+	}
+	if p.RevokeOnRemove {
+		var top credmonTop
+		if err := p.readJSON(user, service+credmonTopSuffix, &top); err == nil {
+			if err = p.server.Revocation.Revoke(top.Mytoken, top.Issuer, true); err != nil {
+				return err
+			}
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	for _, suffix := range []string{credmonUseSuffix, credmonMetaSuffix, credmonTopSuffix, credmonMarkSuffix} {
+		if err := os.Remove(p.path(user, service+suffix)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	// remove the user directory if it is empty, an error means that it is not
+	_ = os.Remove(filepath.Join(p.dir, user))
+	return nil
+}
+
+// Refresh performs a single pass over the credential directory: credentials with a .mark file are removed, .use
+// files without a .top file are deleted, and access tokens that are about to expire are refreshed. Afterwards the
+// CREDMON_COMPLETE file is written.
+// Errors for single credentials are passed to OnError and do not stop the pass.
+func (p *CredmonProducer) Refresh() error {
+	users, err := os.ReadDir(p.dir)
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		if !u.IsDir() {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(p.dir, u.Name()))
+		if err != nil {
+			p.handleError(err)
+			continue
+		}
+		for _, f := range files {
+			p.handleError(p.processFile(u.Name(), f.Name()))
+		}
+	}
+	return os.WriteFile(filepath.Join(p.dir, credmonCompleteFile), nil, 0600)
+}
+
+// Run calls Refresh in the passed interval until the passed context is done; an error is only returned if the
+// credential directory cannot be read
+func (p *CredmonProducer) Run(ctx context.Context, interval time.Duration) error {
+	ticker := p.server.client.getClock().NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := p.Refresh(); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+		}
+	}
+}
+
+func (p *CredmonProducer) processFile(user, name string) error {
+	switch {
+	case strings.HasSuffix(name, credmonMarkSuffix):
+		return p.RemoveCredential(user, strings.TrimSuffix(name, credmonMarkSuffix))
+	case strings.HasSuffix(name, credmonUseSuffix):
+		service := strings.TrimSuffix(name, credmonUseSuffix)
+		if _, err := os.Stat(p.path(user, service+credmonTopSuffix)); os.IsNotExist(err) {
+			return p.RemoveCredential(user, service)
+		}
+	case strings.HasSuffix(name, credmonTopSuffix):
+		service := strings.TrimSuffix(name, credmonTopSuffix)
+		var top credmonTop
+		if err := p.readJSON(user, name, &top); err != nil {
+			if os.IsNotExist(err) {
+				// removed in the meantime, e.g. because of a .mark file
+				return nil
+			}
+			return err
+		}
+		return p.refreshCredential(user, service, top, false)
+	}
+	return nil
+}
+
+// refreshCredential obtains a new access token for the passed credential and writes it to the .use file, if the
+// current one is about to expire or force is set
+func (p *CredmonProducer) refreshCredential(user, service string, top credmonTop, force bool) error {
+	if !force {
+		var use credmonUse
+		if err := p.readJSON(user, service+credmonUseSuffix, &use); err == nil && !p.needsRefresh(use) {
+			return nil
+		}
+	}
+	now := p.server.client.getClock().Now()
+	resp, err := p.server.AccessToken.APIGet(
+		top.Mytoken, top.Issuer, top.Scopes, top.Audiences, "credmon: "+user+"/"+service,
+	)
+	if err != nil {
+		return err
+	}
+	if resp.TokenUpdate != nil {
+		top.Mytoken = resp.TokenUpdate.Mytoken
+		if err = p.writeJSON(user, service+credmonTopSuffix, top); err != nil {
+			return err
+		}
+	}
+	expiresIn := resp.ExpiresIn
+	if expiresIn <= 0 {
+		expiresIn = int64(unknownAccessTokenLifetime / time.Second)
+	}
+	use := credmonUse{
+		AccessToken: resp.AccessToken,
+		TokenType:   resp.TokenType,
+		ExpiresIn:   expiresIn,
+		ExpiresAt:   now.Unix() + expiresIn,
+		Scope:       resp.Scope,
+	}
+	return p.writeJSON(user, service+credmonUseSuffix, use)
+}
+
+func (p *CredmonProducer) needsRefresh(use credmonUse) bool {
+	margin := p.MinValidity
+	if margin == 0 {
+		margin = DefaultMinValidity
+	}
+	if half := time.Duration(use.ExpiresIn) * time.Second / 2; half > margin {
+		margin = half
+	}
+	return time.Unix(use.ExpiresAt, 0).Sub(p.server.client.getClock().Now()) < margin
+}
+
+func (p *CredmonProducer) handleError(err error) {
+	if err != nil && p.OnError != nil {
+		p.OnError(err)
+	}
+}
+
+func (p *CredmonProducer) path(user, file string) string {
+	return filepath.Join(p.dir, user, file)
+}
+
+func (p *CredmonProducer) readJSON(user, file string, v interface{}) error {
+	data, err := os.ReadFile(p.path(user, file))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (p *CredmonProducer) writeJSON(user, file string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(p.path(user, file), data, 0600, nil)
+}
+
+// checkCredmonNames checks that user and service are usable as file names in the credential directory
+func checkCredmonNames(names ...string) error {
+	for _, n := range names {
+		if n == "" || n == "." || n == ".." || strings.ContainsAny(n, `/\`) {
+			return MytokenError{
+				err:          "invalid credential name",
+				errorDetails: n,
+			}
+		}
+	}
+	return nil
+}
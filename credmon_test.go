@@ -0,0 +1,129 @@
+package mytokenlib
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/oidc-mytoken/api/v0"
+)
+
+func TestCredmonProducer(t *testing.T) {
+	start := time.Now()
+	clock := NewFakeClock(start)
+	var issued atomic.Int32
+	issueAccessToken := accessTokenHandler(600, &issued)
+	var revokedMutex sync.Mutex
+	var revoked []string
+	server := newTestMytokenServer(
+		t, func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case testAPIPath + "/token/my":
+				writeJSON(
+					w, http.StatusOK, api.MytokenResponse{
+						Mytoken: "sub-mytoken",
+						MOMID:   "mom",
+						TokenUpdate: &api.MytokenResponse{
+							Mytoken: "rotated-mytoken",
+						},
+					},
+				)
+			case testAPIPath + "/token/access":
+				issueAccessToken(w, r)
+			case testAPIPath + "/token/revoke":
+				var req api.RevocationRequest
+				_ = json.NewDecoder(r.Body).Decode(&req)
+				revokedMutex.Lock()
+				revoked = append(revoked, req.Token)
+				revokedMutex.Unlock()
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}, nil, WithClock(clock),
+	)
+	dir := t.TempDir()
+	producer := NewCredmonProducer(server, dir)
+	producer.RevokeOnRemove = true
+	producer.OnError = func(err error) {
+		t.Errorf("unexpected error: %s", err)
+	}
+	readUse := func() credmonUse {
+		t.Helper()
+		var use credmonUse
+		if err := producer.readJSON("alice", "storage"+credmonUseSuffix, &use); err != nil {
+			t.Fatalf("could not read the .use file: %s", err)
+		}
+		return use
+	}
+
+	mytoken := "mytoken"
+	if err := producer.AddCredential(
+		"alice", "storage", &mytoken, "", nil, nil, []string{"storage.read:/"}, nil,
+	); err != nil {
+		t.Fatalf("could not add credential: %s", err)
+	}
+	if mytoken != "rotated-mytoken" {
+		t.Errorf("expected the passed mytoken to be updated, got %q", mytoken)
+	}
+	var top credmonTop
+	if err := producer.readJSON("alice", "storage"+credmonTopSuffix, &top); err != nil {
+		t.Fatalf("could not read the .top file: %s", err)
+	}
+	if top.Mytoken != "sub-mytoken" || top.MOMID != "mom" {
+		t.Errorf("unexpected .top file content: %+v", top)
+	}
+	if use := readUse(); use.AccessToken != "at1" || use.ExpiresAt != start.Unix()+600 {
+		t.Errorf("unexpected .use file content: %+v", use)
+	}
+
+	// an orphaned .use file is removed
+	if err := os.MkdirAll(filepath.Join(dir, "bob"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := producer.writeJSON("bob", "compute"+credmonUseSuffix, credmonUse{AccessToken: "orphan"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := producer.Refresh(); err != nil {
+		t.Fatalf("refresh failed: %s", err)
+	}
+	if use := readUse(); use.AccessToken != "at1" {
+		t.Errorf("expected the access token not to be refreshed yet, got %q", use.AccessToken)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bob")); !os.IsNotExist(err) {
+		t.Errorf("expected the orphaned credential to be removed, stat returned: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, credmonCompleteFile)); err != nil {
+		t.Errorf("expected the %s file to be written: %s", credmonCompleteFile, err)
+	}
+
+	// access tokens are refreshed once half of their lifetime has passed
+	clock.Advance(5*time.Minute + time.Second)
+	if err := producer.Refresh(); err != nil {
+		t.Fatalf("refresh failed: %s", err)
+	}
+	if use := readUse(); use.AccessToken != "at2" || use.ExpiresAt != clock.Now().Unix()+600 {
+		t.Errorf("expected the access token to be refreshed, got %+v", use)
+	}
+
+	// a .mark file removes and revokes the credential
+	if err := os.WriteFile(producer.path("alice", "storage"+credmonMarkSuffix), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := producer.Refresh(); err != nil {
+		t.Fatalf("refresh failed: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "alice")); !os.IsNotExist(err) {
+		t.Errorf("expected the marked credential to be removed, stat returned: %v", err)
+	}
+	revokedMutex.Lock()
+	defer revokedMutex.Unlock()
+	if len(revoked) != 1 || revoked[0] != "sub-mytoken" {
+		t.Errorf("expected the sub-mytoken to be revoked, got %v", revoked)
+	}
+}
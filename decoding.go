@@ -0,0 +1,198 @@
+package mytokenlib
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrUnknownField is returned in strict decoding mode if a response contains fields that are not known to the
+// library, see WithStrictDecoding. Use errors.Is to check for it.
+var ErrUnknownField = MytokenError{err: "unknown field in response"}
+
+// UnknownField describes a field of a response that is not known to the library, i.e. that is not part of the type
+// from github.com/oidc-mytoken/api the response is decoded into; this usually means that the server's api changed
+type UnknownField struct {
+	// Method is the http method of the request
+	Method string
+	// Endpoint is the url the request was sent to
+	Endpoint string
+	// Type is the type the response is decoded into, e.g. "api.AccessTokenResponse"
+	Type string
+	// Field is the path of the unknown field, e.g. "token_update.foo" or "providers[0].foo"
+	Field string
+}
+
+// WithStrictDecoding enables the strict decoding mode: responses that contain fields that are not known to the
+// library fail with an error matching ErrUnknownField that names the fields. This allows to detect changes of the
+// server's api early, e.g. in CI. In the default lenient mode unknown fields are ignored, but reported to the
+// handler set with WithUnknownFieldHandler or, if there is none, logged as warnings (see WithLogger).
+func WithStrictDecoding(strict bool) Option {
+	return func(c *client) error {
+		c.strictDecoding = strict
+		return nil
+	}
+}
+
+// WithUnknownFieldHandler sets a handler that is called for each field of a response that is not known to the
+// library in the lenient decoding mode, see WithStrictDecoding
+func WithUnknownFieldHandler(handler func(UnknownField)) Option {
+	return func(c *client) error {
+		c.unknownFieldHandler = handler
+		return nil
+	}
+}
+
+// checkUnknownFields checks the passed response data, which is decoded into v, for unknown fields; in strict decoding
+// mode an error is returned, otherwise the fields are reported
+func (c *client) checkUnknownFields(method, url string, data []byte, v interface{}) error {
+	if c == nil || (!c.strictDecoding && c.unknownFieldHandler == nil && c.logger == nil) {
+		return nil
+	}
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Pointer {
+		return nil
+	}
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		// the actual decoding reports the error
+		return nil
+	}
+	fields := unknownFields(value, t.Elem(), "")
+	if len(fields) == 0 {
+		return nil
+	}
+	typeName := t.Elem().String()
+	if c.strictDecoding {
+		return MytokenError{
+			err: ErrUnknownField.err,
+			errorDetails: fmt.Sprintf(
+				"%s %s: %s has no fields '%s'", method, url, typeName, strings.Join(fields, "', '"),
+			),
+		}
+	}
+	for _, field := range fields {
+		f := UnknownField{
+			Method:   method,
+			Endpoint: url,
+			Type:     typeName,
+			Field:    field,
+		}
+		if c.unknownFieldHandler != nil {
+			c.unknownFieldHandler(f)
+		} else {
+			c.log(
+				slog.LevelWarn, "unknown field in mytoken response", "request", method+" "+url, "type", typeName,
+				"field", field,
+			)
+		}
+	}
+	return nil
+}
+
+var unmarshalerType = reflect.TypeFor[json.Unmarshaler]()
+
+// unknownFields returns the paths of the fields of the passed decoded json value that are not known to the passed
+// type; values that are decoded by a json.Unmarshaler are not checked
+func unknownFields(value any, t reflect.Type, path string) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if reflect.PointerTo(t).Implements(unmarshalerType) {
+		return nil
+	}
+	var unknown []string
+	switch t.Kind() {
+	case reflect.Struct:
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		fields := jsonFields(t)
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			field, ok := fields[key]
+			if !ok {
+				// encoding/json matches field names case-insensitively
+				field, ok = fields[strings.ToLower(key)]
+			}
+			if !ok {
+				unknown = append(unknown, joinFieldPath(path, key))
+				continue
+			}
+			unknown = append(unknown, unknownFields(object[key], field, joinFieldPath(path, key))...)
+		}
+	case reflect.Map:
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		for key, v := range object {
+			unknown = append(unknown, unknownFields(v, t.Elem(), joinFieldPath(path, key))...)
+		}
+		slices.Sort(unknown)
+	case reflect.Slice, reflect.Array:
+		array, ok := value.([]any)
+		if !ok {
+			return nil
+		}
+		for i, v := range array {
+			unknown = append(unknown, unknownFields(v, t.Elem(), path+"["+strconv.Itoa(i)+"]")...)
+		}
+	}
+	return unknown
+}
+
+// jsonFields returns the types of the fields of the passed struct type by their json names and their lower case json
+// names; the fields of embedded structs are included as encoding/json does
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			embedded := f.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				for n, ft := range jsonFields(embedded) {
+					if _, ok := fields[n]; !ok {
+						fields[n] = ft
+					}
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+		if _, ok := fields[strings.ToLower(name)]; !ok {
+			fields[strings.ToLower(name)] = f.Type
+		}
+	}
+	return fields
+}
+
+func joinFieldPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
@@ -0,0 +1,148 @@
+package mytokenlib
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/oidc-mytoken/api/v0"
+)
+
+// unknownFieldsResponse is an access token response with unknown fields at different levels
+const unknownFieldsResponse = `{
+	"access_token": "at",
+	"Token_Type": "Bearer",
+	"new_field": 1,
+	"token_update": {"mytoken": "mt", "rotation_hint": true},
+	"audience": ["a"]
+}`
+
+func TestUnknownFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		v        any
+		expected []string
+	}{
+		{
+			name:     "nested fields",
+			data:     unknownFieldsResponse,
+			v:        &api.AccessTokenResponse{},
+			expected: []string{"new_field", "token_update.rotation_hint"},
+		},
+		{
+			name:     "slices",
+			data:     `{"providers_supported": [{"issuer": "https://a"}, {"issuer": "https://b", "logo": "x"}]}`,
+			v:        &api.MytokenConfiguration{},
+			expected: []string{"providers_supported[1].logo"},
+		},
+		{
+			name:     "maps",
+			data:     `{"a": {"access_token": "at", "extra": 1}}`,
+			v:        &map[string]api.AccessTokenResponse{},
+			expected: []string{"a.extra"},
+		},
+		{
+			name: "known fields",
+			data: `{"access_token": "at", "ACCESS_TOKEN": "at", "token_type": "Bearer"}`,
+			v:    &api.AccessTokenResponse{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				var value any
+				if err := json.Unmarshal([]byte(test.data), &value); err != nil {
+					t.Fatal(err)
+				}
+				fields := unknownFields(value, reflect.TypeOf(test.v).Elem(), "")
+				if !reflect.DeepEqual(fields, test.expected) {
+					t.Errorf("expected %q, got %q", test.expected, fields)
+				}
+			},
+		)
+	}
+}
+
+func TestStrictDecoding(t *testing.T) {
+	server := newTestMytokenServer(
+		t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", mimetypeJSON)
+			_, _ = w.Write([]byte(unknownFieldsResponse))
+		}, nil, WithStrictDecoding(true),
+	)
+	_, err := server.AccessToken.APIGet("mytoken", "", nil, nil, "")
+	if !errors.Is(err, ErrUnknownField) {
+		t.Fatalf("expected ErrUnknownField, got %v", err)
+	}
+	for _, field := range []string{"new_field", "token_update.rotation_hint", "api.AccessTokenResponse"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("expected the error to name %q, got %s", field, err)
+		}
+	}
+}
+
+func TestUnknownFieldHandler(t *testing.T) {
+	var mutex sync.Mutex
+	var reported []UnknownField
+	server := newTestMytokenServer(
+		t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", mimetypeJSON)
+			_, _ = w.Write([]byte(unknownFieldsResponse))
+		}, nil, WithUnknownFieldHandler(
+			func(f UnknownField) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				reported = append(reported, f)
+			},
+		),
+	)
+	at, err := server.AccessToken.APIGet("mytoken", "", nil, nil, "")
+	if err != nil {
+		t.Fatalf("expected unknown fields to be accepted in lenient mode, got %s", err)
+	}
+	if at.AccessToken != "at" || at.TokenType != "Bearer" {
+		t.Errorf("expected the response to be decoded, got %+v", at)
+	}
+	expected := []UnknownField{
+		{
+			Method:   http.MethodPost,
+			Endpoint: server.AccessToken.endpoint,
+			Type:     "api.AccessTokenResponse",
+			Field:    "new_field",
+		},
+		{
+			Method:   http.MethodPost,
+			Endpoint: server.AccessToken.endpoint,
+			Type:     "api.AccessTokenResponse",
+			Field:    "token_update.rotation_hint",
+		},
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if !reflect.DeepEqual(reported, expected) {
+		t.Errorf("expected %+v, got %+v", expected, reported)
+	}
+}
+
+func TestUnknownFieldsAreLogged(t *testing.T) {
+	var logs bytes.Buffer
+	server := newTestMytokenServer(
+		t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", mimetypeJSON)
+			_, _ = w.Write([]byte(unknownFieldsResponse))
+		}, nil, WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+	)
+	if _, err := server.AccessToken.APIGet("mytoken", "", nil, nil, ""); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if out := logs.String(); !strings.Contains(out, "unknown field") || !strings.Contains(out, "field=new_field") {
+		t.Errorf("expected the unknown fields to be logged, got %q", out)
+	}
+}
@@ -0,0 +1,231 @@
+package mytokenlib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDiscoveryCacheTTL is the duration cached discovery documents are considered fresh if the server does not
+// send caching headers
+const DefaultDiscoveryCacheTTL = time.Hour
+
+const (
+	// backgroundRefreshInitialBackoff is the delay before the first background refresh of a discovery document
+	backgroundRefreshInitialBackoff = 30 * time.Second
+	// backgroundRefreshMaxBackoff is the maximum delay between two background refresh attempts
+	backgroundRefreshMaxBackoff = 15 * time.Minute
+	// backgroundRefreshMaxAttempts is the number of background refresh attempts before giving up
+	backgroundRefreshMaxAttempts = 10
+)
+
+// DiscoveryCache caches the discovery documents of mytoken servers, i.e. the api.MytokenConfiguration and the
+// api.SettingsMetaData, on disk. Documents are considered fresh as long as allowed by the HTTP caching headers sent by
+// the server, or for TTL if there are none; fresh documents are used without contacting the server. If discovery
+// fails, a stale document is used instead and the discovery is retried in the background.
+// The background refresh only updates the cache: a MytokenServer created from a stale document keeps using it, the
+// refreshed document takes effect when the next MytokenServer is created, e.g. on the next start of the application.
+type DiscoveryCache struct {
+	// TTL is the duration documents are considered fresh if the server does not send caching headers; if 0,
+	// DefaultDiscoveryCacheTTL is used
+	TTL time.Duration
+
+	dir string
+
+	mutex      sync.Mutex
+	refreshing map[string]bool
+}
+
+// cachedDocument is a discovery document as it is stored on disk
+type cachedDocument struct {
+	URL     string          `json:"url"`
+	Fetched time.Time       `json:"fetched"`
+	Expires time.Time       `json:"expires"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// NewDiscoveryCache creates a new DiscoveryCache that stores documents in the passed directory
+func NewDiscoveryCache(dir string) *DiscoveryCache {
+	return &DiscoveryCache{
+		dir:        dir,
+		refreshing: map[string]bool{},
+	}
+}
+
+// DefaultDiscoveryCacheDir returns the default directory for a DiscoveryCache, which is a "mytokenlib" directory in
+// the user's cache directory
+func DefaultDiscoveryCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "mytokenlib"), nil
+}
+
+func (dc *DiscoveryCache) path(url string) string {
+	hash := sha256.Sum256([]byte(url))
+	return filepath.Join(dc.dir, hex.EncodeToString(hash[:])+".json")
+}
+
+// load returns the cached document for the passed url, or nil if there is none
+func (dc *DiscoveryCache) load(url string) *cachedDocument {
+	data, err := os.ReadFile(dc.path(url))
+	if err != nil {
+		return nil
+	}
+	var doc cachedDocument
+	if err = json.Unmarshal(data, &doc); err != nil || doc.URL != url {
+		return nil
+	}
+	return &doc
+}
+
+// store stores the passed document for the passed url honouring the caching headers of the passed http.Response;
+// now is the current time and skew the clock skew of the server, see MytokenServer.ClockSkew
+func (dc *DiscoveryCache) store(
+	url string, data json.RawMessage, resp *http.Response, now time.Time, skew time.Duration,
+) error {
+	ttl, cacheable := dc.ttl(resp, now, skew)
+	if !cacheable {
+		return nil
+	}
+	doc := cachedDocument{
+		URL:     url,
+		Fetched: now,
+		Expires: now.Add(ttl),
+		Data:    data,
+	}
+	content, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dc.dir, 0700); err != nil {
+		return err
+	}
+	return writeFileAtomic(dc.path(url), content, 0600, nil)
+}
+
+// ttl returns how long a response is fresh according to its caching headers and if it may be stored at all
+func (dc *DiscoveryCache) ttl(resp *http.Response, now time.Time, skew time.Duration) (time.Duration, bool) {
+	defaultTTL := dc.TTL
+	if defaultTTL == 0 {
+		defaultTTL = DefaultDiscoveryCacheTTL
+	}
+	if resp == nil {
+		return defaultTTL, true
+	}
+	for _, directive := range strings.Split(resp.Header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(strings.ToLower(directive)), "=")
+		switch name {
+		case "no-store":
+			return 0, false
+		case "no-cache":
+			return 0, true
+		case "max-age":
+			secs, err := strconv.Atoi(strings.Trim(value, `"`))
+			if err != nil {
+				continue
+			}
+			age, _ := strconv.Atoi(resp.Header.Get("Age"))
+			return time.Duration(secs-age) * time.Second, true
+		}
+	}
+	if expires := resp.Header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			// invalid dates mean that the response is already expired
+			return 0, true
+		}
+		date, err := http.ParseTime(resp.Header.Get("Date"))
+		if err != nil {
+			// Expires is a time of the server's clock
+			date = now.Add(skew)
+		}
+		return t.Sub(date), true
+	}
+	return defaultTTL, true
+}
+
+// discover obtains the JSON discovery document at the passed url and decodes it into v. If a DiscoveryCache is
+// configured, a fresh cached document is used without a request, a fetched document is stored, and a stale cached
+// document is used if the request fails.
+func (c *client) discover(url string, v interface{}) error {
+	cache := c.getDiscoveryCache()
+	if cache == nil {
+		return c.doHTTPRequest("GET", url, nil, v)
+	}
+	cached := cache.load(url)
+	if cached != nil && c.getClock().Now().Before(cached.Expires) {
+		if err := json.Unmarshal(cached.Data, v); err == nil {
+			return nil
+		}
+	}
+	data, err := c.fetchDiscoveryDocument(url)
+	if err != nil {
+		if cached == nil {
+			return err
+		}
+		if json.Unmarshal(cached.Data, v) != nil {
+			return err
+		}
+		c.refreshInBackground(cache, url)
+		return nil
+	}
+	if err = c.checkUnknownFields("GET", url, data, v); err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return c.decodingError(err)
+	}
+	return nil
+}
+
+// fetchDiscoveryDocument requests the discovery document at the passed url and stores it in the DiscoveryCache
+func (c *client) fetchDiscoveryDocument(url string) (json.RawMessage, error) {
+	var data json.RawMessage
+	resp, err := c.doRequest("GET", url, nil, &data, "")
+	if err != nil {
+		return nil, err
+	}
+	if cache := c.getDiscoveryCache(); cache != nil {
+		// failing to cache the document must not fail the discovery
+		_ = cache.store(url, data, resp, c.getClock().Now(), c.getClockSkew())
+	}
+	return data, nil
+}
+
+// refreshInBackground retries to fetch the discovery document at the passed url in the background until it succeeds,
+// so that the DiscoveryCache is up to date again; the refreshed document is not applied to the MytokenServer that
+// uses the stale document, since its exported fields must not change concurrently
+func (c *client) refreshInBackground(cache *DiscoveryCache, url string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if cache.refreshing[url] {
+		return
+	}
+	cache.refreshing[url] = true
+	go func() {
+		defer func() {
+			cache.mutex.Lock()
+			delete(cache.refreshing, url)
+			cache.mutex.Unlock()
+		}()
+		backoff := backgroundRefreshInitialBackoff
+		for i := 0; i < backgroundRefreshMaxAttempts; i++ {
+			if !c.sleep(backoff) {
+				return
+			}
+			if _, err := c.fetchDiscoveryDocument(url); err == nil {
+				return
+			}
+			backoff = min(2*backoff, backgroundRefreshMaxBackoff)
+		}
+	}()
+}
@@ -0,0 +1,82 @@
+package mytokenlib
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/oidc-mytoken/api/v0"
+)
+
+func TestDiscoveryCacheBackgroundRefresh(t *testing.T) {
+	var failing atomic.Bool
+	var version atomic.Value
+	version.Store("1.0.0")
+	srv := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if failing.Load() {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				writeJSON(
+					w, http.StatusOK, api.MytokenConfiguration{
+						Issuer:          "http://" + r.Host,
+						MytokenEndpoint: "http://" + r.Host + testAPIPath + "/token/my",
+						Version:         version.Load().(string),
+					},
+				)
+			},
+		),
+	)
+	defer srv.Close()
+	clock := NewFakeClock(time.Now())
+	cache := NewDiscoveryCache(t.TempDir())
+	cache.TTL = time.Minute
+	newServer := func() *MytokenServer {
+		server, err := NewMytokenServerWithOptions(
+			srv.URL, WithDiscoveryCache(cache), WithClock(clock), WithRetryPolicy(RetryPolicy{MaxAttempts: 1}),
+		)
+		if err != nil {
+			t.Fatalf("could not create mytoken server: %s", err)
+		}
+		return server
+	}
+
+	newServer()
+	clock.Advance(2 * time.Minute)
+	failing.Store(true)
+	version.Store("1.1.0")
+	stale := newServer()
+	if v := stale.ServerMetadata.Version; v != "1.0.0" {
+		t.Fatalf("expected the stale cached metadata to be used, got version %q", v)
+	}
+
+	failing.Store(false)
+	clock.BlockUntilWaiters(1)
+	clock.Advance(backgroundRefreshInitialBackoff)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cache.mutex.Lock()
+		refreshing := cache.refreshing[srv.URL+"/.well-known/mytoken-configuration"]
+		cache.mutex.Unlock()
+		if !refreshing {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the background refresh did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the refresh only updates the cache, not the running MytokenServer
+	if v := stale.ServerMetadata.Version; v != "1.0.0" {
+		t.Errorf("expected the running server to keep its metadata, got version %q", v)
+	}
+	failing.Store(true)
+	if v := newServer().ServerMetadata.Version; v != "1.1.0" {
+		t.Errorf("expected a new server to use the refreshed metadata from the cache, got version %q", v)
+	}
+}
@@ -4,6 +4,9 @@ package mytokenlib
 type MytokenError struct {
 	err          string
 	errorDetails string
+	// requestID and statusCode are set for errors returned for requests to a mytoken server
+	requestID  string
+	statusCode int
 }
 
 // Error implements the error interface and returns a string representation of this MytokenError
@@ -21,3 +24,10 @@ func newMytokenErrorFromError(e string, err error) MytokenError {
 		errorDetails: err.Error(),
 	}
 }
+
+// Is reports whether target is a MytokenError with the same error; the error details are only compared if target has
+// any. This allows to check errors against predefined errors with errors.Is
+func (err MytokenError) Is(target error) bool {
+	t, ok := target.(MytokenError)
+	return ok && t.err == err.err && (t.errorDetails == "" || t.errorDetails == err.errorDetails)
+}
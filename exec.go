@@ -0,0 +1,130 @@
+package mytokenlib
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+// DefaultAccessTokenEnvVars are the environment variables an access token is exported as by RunWithAccessToken if no
+// other variables are configured
+var DefaultAccessTokenEnvVars = []string{
+	"ACCESS_TOKEN",
+	"BEARER_TOKEN",
+}
+
+// DefaultTokenFileEnvVars are the environment variables the path of the access token file is exported as by
+// RunWithAccessToken if no other variables are configured
+var DefaultTokenFileEnvVars = []string{"BEARER_TOKEN_FILE"}
+
+// forwardedSignals are the signals that are passed on to a child process started by RunWithAccessToken
+var forwardedSignals = []os.Signal{
+	os.Interrupt,
+	syscall.SIGTERM,
+	syscall.SIGHUP,
+	syscall.SIGQUIT,
+}
+
+// RunConfig holds the configuration for RunWithAccessToken
+type RunConfig struct {
+	// EnvVars are the names of the environment variables the access token is exported as; if empty,
+	// DefaultAccessTokenEnvVars are used
+	EnvVars []string
+	// TokenFile is the path of a file the access token is written to and kept up to date while the command runs;
+	// this is useful for long-running commands that outlive a single access token. If empty, no file is written.
+	TokenFile string
+	// TokenFileEnvVars are the names of the environment variables the path of the TokenFile is exported as; if
+	// empty, DefaultTokenFileEnvVars are used
+	TokenFileEnvVars []string
+	// Stdin, Stdout, and Stderr are passed to the command; if nil, the streams of the current process are used
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// OnRefreshError is called if refreshing the access token in the TokenFile fails
+	OnRefreshError func(error)
+}
+
+// RunWithAccessToken obtains an access token from the passed AccessTokenSource and runs the passed command with the
+// access token exported in its environment. If a TokenFile is configured, the access token is also written to this
+// file and refreshed there until the command exits. Signals received by the current process are forwarded to the
+// command.
+// The exit code of the command is returned; for a command terminated by a signal it is 128 plus the signal number.
+// An error is only returned if the command could not be run.
+func RunWithAccessToken(source *AccessTokenSource, config RunConfig, name string, args ...string) (int, error) {
+	token, err := source.Token()
+	if err != nil {
+		return -1, err
+	}
+	cmd := exec.Command(name, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = config.Stdin, config.Stdout, config.Stderr
+	if cmd.Stdin == nil {
+		cmd.Stdin = os.Stdin
+	}
+	if cmd.Stdout == nil {
+		cmd.Stdout = os.Stdout
+	}
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+	cmd.Env = os.Environ()
+	envVars := config.EnvVars
+	if len(envVars) == 0 {
+		envVars = DefaultAccessTokenEnvVars
+	}
+	for _, v := range envVars {
+		cmd.Env = append(cmd.Env, v+"="+token)
+	}
+
+	loopCtx, stopLoop := context.WithCancel(context.Background())
+	defer stopLoop()
+	if config.TokenFile != "" {
+		sink := NewFileSink(source, FileSinkTarget{Path: config.TokenFile})
+		sink.OnError = config.OnRefreshError
+		if err = sink.Update(); err != nil {
+			return -1, err
+		}
+		loopDone := make(chan struct{})
+		go func() {
+			defer close(loopDone)
+			sink.keepFresh(loopCtx)
+		}()
+		defer func() {
+			// the refresh loop must have finished before the file is removed, otherwise a refresh could write it again
+			stopLoop()
+			<-loopDone
+			_ = sink.Remove()
+		}()
+		fileEnvVars := config.TokenFileEnvVars
+		if len(fileEnvVars) == 0 {
+			fileEnvVars = DefaultTokenFileEnvVars
+		}
+		for _, v := range fileEnvVars {
+			cmd.Env = append(cmd.Env, v+"="+config.TokenFile)
+		}
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+	if err = cmd.Start(); err != nil {
+		signal.Stop(signals)
+		return -1, err
+	}
+	go func() {
+		for s := range signals {
+			_ = cmd.Process.Signal(s)
+		}
+	}()
+	err = cmd.Wait()
+	signal.Stop(signals)
+	close(signals)
+	if cmd.ProcessState == nil {
+		return -1, err
+	}
+	if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal()), nil
+	}
+	return cmd.ProcessState.ExitCode(), nil
+}
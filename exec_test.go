@@ -0,0 +1,37 @@
+package mytokenlib
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunWithAccessTokenRemovesTokenFile(t *testing.T) {
+	var issued atomic.Int32
+	server := newTestMytokenServer(t, accessTokenHandler(1, &issued), nil)
+	source := NewAccessTokenSource(server.AccessToken, "mytoken", "", nil, nil, "")
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	// the access tokens are valid for one second, so the token file is refreshed while the command runs
+	code, err := RunWithAccessToken(
+		source, RunConfig{TokenFile: tokenFile}, "sh", "-c", `test -s "$BEARER_TOKEN_FILE" && sleep 1.2`,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+	if issued.Load() < 2 {
+		t.Errorf("expected the token file to be refreshed, only %d access tokens were issued", issued.Load())
+	}
+	if _, err = os.Stat(tokenFile); !os.IsNotExist(err) {
+		t.Fatalf("expected the token file to be removed, stat returned: %v", err)
+	}
+	// a refresh that was still running must not write the file again
+	time.Sleep(time.Second)
+	if _, err = os.Stat(tokenFile); !os.IsNotExist(err) {
+		t.Fatalf("expected the token file to stay removed, stat returned: %v", err)
+	}
+}
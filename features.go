@@ -0,0 +1,183 @@
+package mytokenlib
+
+import (
+	"slices"
+
+	"github.com/oidc-mytoken/api/v0"
+)
+
+// Feature is an optional feature of a mytoken server, see MytokenServer.Supports
+type Feature string
+
+// Features that can be queried with MytokenServer.Supports
+const (
+	FeatureTokeninfo     Feature = "tokeninfo"
+	FeatureRevocation    Feature = "revocation"
+	FeatureTransfer      Feature = "token_transfer"
+	FeatureSSH           Feature = "ssh"
+	FeatureNotifications Feature = "notifications"
+	FeatureCalendars     Feature = "calendars"
+	FeatureProfiles      Feature = "profiles"
+	FeatureTags          Feature = "tags"
+	FeatureEmail         Feature = "email"
+)
+
+// errUnsupported returns an error matching ErrUnsupportedByServer with the passed details
+func errUnsupported(details string) error {
+	return MytokenError{
+		err:          ErrUnsupportedByServer.err,
+		errorDetails: details,
+	}
+}
+
+// supported checks if value is contained in the list of supported values; an empty list means that the server does
+// not advertise the supported values, so every value is considered supported
+func supported(list []string, value string) bool {
+	return len(list) == 0 || slices.Contains(list, value)
+}
+
+// Supports checks if the server supports the passed Feature. The tags and email features are advertised in the user
+// settings metadata, which is discovered if needed; an error is only returned if this discovery fails.
+func (s *MytokenServer) Supports(feature Feature) (bool, error) {
+	return supportsFeature(s.ServerMetadata, feature, s.UserSettings.MetaData)
+}
+
+// SupportsGrantType checks if the server supports the passed grant type at the passed endpoint; only the
+// EndpointAccessToken and EndpointMytoken endpoints have grant types. If the server does not advertise the supported
+// grant types, true is returned.
+func (s *MytokenServer) SupportsGrantType(endpoint EndpointName, grantType string) bool {
+	return supportsGrantType(s.ServerMetadata, endpoint, grantType)
+}
+
+// SupportsResponseType checks if the server supports the passed response type for mytokens. If the server does not
+// advertise the supported response types, true is returned.
+func (s *MytokenServer) SupportsResponseType(responseType string) bool {
+	return supported(s.ServerMetadata.ResponseTypesSupported, responseType)
+}
+
+// SupportsOIDCFlow checks if the server supports the passed oidc flow for obtaining mytokens. If the server does not
+// advertise the supported flows, true is returned.
+func (s *MytokenServer) SupportsOIDCFlow(flow string) bool {
+	return supported(s.ServerMetadata.MytokenEndpointOIDCFlowsSupported, flow)
+}
+
+// SupportsTokeninfoAction checks if the server supports the passed action at the tokeninfo endpoint; the supported
+// actions differ between server versions. If the server does not advertise the supported actions, true is returned
+// if it has a tokeninfo endpoint.
+func (s *MytokenServer) SupportsTokeninfoAction(action string) bool {
+	return s.ServerMetadata.TokeninfoEndpoint != "" &&
+		supported(s.ServerMetadata.TokenInfoEndpointActionsSupported, action)
+}
+
+func supportsGrantType(metadata api.MytokenConfiguration, endpoint EndpointName, grantType string) bool {
+	switch endpoint {
+	case EndpointAccessToken:
+		return supported(metadata.AccessTokenEndpointGrantTypesSupported, grantType)
+	case EndpointMytoken:
+		return supported(metadata.MytokenEndpointGrantTypesSupported, grantType)
+	}
+	return false
+}
+
+// supportsFeature checks if a server with the passed metadata supports the passed Feature; settingsMetadata is used
+// to obtain the api.SettingsMetaData if needed, if it is nil, features that need it are assumed to be supported
+func supportsFeature(
+	metadata api.MytokenConfiguration, feature Feature, settingsMetadata func() (api.SettingsMetaData, error),
+) (bool, error) {
+	switch feature {
+	case FeatureTokeninfo:
+		return metadata.TokeninfoEndpoint != "", nil
+	case FeatureRevocation:
+		return metadata.RevocationEndpoint != "", nil
+	case FeatureTransfer:
+		return metadata.TokenTransferEndpoint != "", nil
+	case FeatureSSH:
+		if len(metadata.SSHKeys) > 0 {
+			return true, nil
+		}
+		mtGrants, atGrants := metadata.MytokenEndpointGrantTypesSupported, metadata.AccessTokenEndpointGrantTypesSupported
+		if len(mtGrants) == 0 && len(atGrants) == 0 {
+			// the server does not advertise its grant types
+			return true, nil
+		}
+		return slices.Contains(mtGrants, api.GrantTypeSSH) || slices.Contains(atGrants, api.GrantTypeSSH), nil
+	case FeatureNotifications, FeatureCalendars:
+		return metadata.NotificationsEndpoint != "", nil
+	case FeatureProfiles:
+		return metadata.ProfilesEndpoint != "", nil
+	case FeatureTags, FeatureEmail:
+		if metadata.UserSettingsEndpoint == "" {
+			return false, nil
+		}
+		if settingsMetadata == nil {
+			// not known without a discovery
+			return true, nil
+		}
+		m, err := settingsMetadata()
+		if err != nil {
+			return false, err
+		}
+		if feature == FeatureTags {
+			return m.TagsEndpoint != "", nil
+		}
+		return m.EmailEndpoint != "", nil
+	}
+	return false, nil
+}
+
+// requireGrantType returns an error matching ErrUnsupportedByServer if the server does not support the passed grant
+// type at the passed endpoint
+func (c *client) requireGrantType(endpoint EndpointName, grantType string) error {
+	if c == nil || c.metadata == nil || supportsGrantType(*c.metadata, endpoint, grantType) {
+		return nil
+	}
+	return errUnsupported("grant type '" + grantType + "' at the " + string(endpoint) + " endpoint")
+}
+
+// requireResponseType returns an error matching ErrUnsupportedByServer if the server does not support the passed
+// response type; an empty response type means the default and is always supported
+func (c *client) requireResponseType(responseType string) error {
+	if responseType == "" || c == nil || c.metadata == nil ||
+		supported(c.metadata.ResponseTypesSupported, responseType) {
+		return nil
+	}
+	return errUnsupported("response type '" + responseType + "'")
+}
+
+// requireOIDCFlow returns an error matching ErrUnsupportedByServer if the server does not support the passed oidc
+// flow
+func (c *client) requireOIDCFlow(flow string) error {
+	if c == nil || c.metadata == nil || supported(c.metadata.MytokenEndpointOIDCFlowsSupported, flow) {
+		return nil
+	}
+	return errUnsupported("oidc flow '" + flow + "'")
+}
+
+// requireTokeninfoAction returns an error matching ErrUnsupportedByServer if the server does not support the passed
+// tokeninfo action
+func (c *client) requireTokeninfoAction(action string) error {
+	if c == nil || c.metadata == nil || supported(c.metadata.TokenInfoEndpointActionsSupported, action) {
+		return nil
+	}
+	return errUnsupported("tokeninfo action '" + action + "'")
+}
+
+// requireFeature returns an error matching ErrUnsupportedByServer if the server does not support the passed Feature;
+// the check is skipped if one of the passed endpoints is overridden (see WithEndpointOverride). The tags and email
+// features are checked against the user settings metadata, which is discovered if needed; if this discovery fails,
+// the request is not blocked.
+func (c *client) requireFeature(feature Feature, endpoints ...EndpointName) error {
+	if c == nil || c.metadata == nil {
+		return nil
+	}
+	for _, endpoint := range endpoints {
+		if _, ok := c.override(endpoint); ok {
+			return nil
+		}
+	}
+	ok, err := supportsFeature(*c.metadata, feature, c.settingsMetadata)
+	if ok || err != nil {
+		return nil
+	}
+	return errUnsupported(string(feature))
+}
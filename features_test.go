@@ -0,0 +1,144 @@
+package mytokenlib
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/oidc-mytoken/api/v0"
+)
+
+func TestUnsupportedEndpointsFailFast(t *testing.T) {
+	var requests atomic.Int32
+	server := newTestMytokenServer(
+		t, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == testAPIPath+"/settings" {
+				// the server supports neither tags nor email
+				writeJSON(w, http.StatusOK, api.SettingsMetaData{})
+				return
+			}
+			requests.Add(1)
+			writeJSON(w, http.StatusOK, api.OnlyTokenUpdateResponse{})
+		}, nil,
+	)
+	// optional endpoints the server does not advertise are not set
+	if server.Notifications != nil || server.Calendars != nil || server.ProfilesAndTemplates != nil {
+		t.Errorf(
+			"expected the unsupported endpoints to be nil, got %v, %v, %v", server.Notifications, server.Calendars,
+			server.ProfilesAndTemplates,
+		)
+	}
+	// the support of the user settings sub-endpoints is only known after their discovery
+	checks := map[string]func() error{
+		"mytoken tags": func() error {
+			_, err := server.Mytoken.Tags().APIAdd(api.AddTagToMytokenRequest{})
+			return err
+		},
+		"tags settings": func() error {
+			_, err := server.UserSettings.Tags.APIGet("mytoken")
+			return err
+		},
+		"email settings": func() error {
+			_, err := server.UserSettings.Email.APIGet("mytoken")
+			return err
+		},
+	}
+	for name, check := range checks {
+		if err := check(); !errors.Is(err, ErrUnsupportedByServer) {
+			t.Errorf("%s: expected an error matching ErrUnsupportedByServer, got: %v", name, err)
+		}
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("expected no requests to unsupported endpoints, got %d", n)
+	}
+}
+
+func TestSupportedTagsAreNotBlocked(t *testing.T) {
+	var requests atomic.Int32
+	var server *MytokenServer
+	server = newTestMytokenServer(
+		t, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == testAPIPath+"/settings" {
+				writeJSON(
+					w, http.StatusOK, api.SettingsMetaData{TagsEndpoint: server.url + testAPIPath + "/settings/tags"},
+				)
+				return
+			}
+			requests.Add(1)
+			writeJSON(w, http.StatusOK, api.OnlyTokenUpdateResponse{})
+		}, nil,
+	)
+	if _, err := server.Mytoken.Tags().APIAdd(api.AddTagToMytokenRequest{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("expected the request to be sent, got %d requests", n)
+	}
+}
+
+func TestOptionalEndpointsAreResolvedLazily(t *testing.T) {
+	var paths []string
+	srv := newTestServer(
+		t, func(w http.ResponseWriter, r *http.Request) {
+			paths = append(paths, r.URL.Path)
+			writeJSON(w, http.StatusOK, api.OnlyTokenUpdateResponse{})
+		}, nil,
+	)
+	// the server does not advertise notifications, but the endpoint is overridden
+	server, err := NewMytokenServerWithOptions(
+		srv.URL, WithEndpointOverride(EndpointNotifications, srv.URL+"/notifications"),
+	)
+	if err != nil {
+		t.Fatalf("could not create mytoken server: %s", err)
+	}
+	if _, err = server.Calendars.APIDelete("mytoken", "calendar"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(paths) != 1 || paths[0] != "/notifications/calendars/calendar" {
+		t.Errorf("expected a request to the derived calendars endpoint, got %v", paths)
+	}
+	if server.ProfilesAndTemplates != nil {
+		t.Error("expected the profiles endpoint that is neither advertised nor overridden to be nil")
+	}
+}
+
+func TestUserSettingsSubEndpointsOfRestoredServer(t *testing.T) {
+	server := newTestMytokenServer(
+		t, func(w http.ResponseWriter, r *http.Request) {
+			// the server supports tags but not email
+			tags := "http://" + r.Host + testAPIPath + "/settings/tags"
+			writeJSON(w, http.StatusOK, api.SettingsMetaData{TagsEndpoint: tags})
+		}, nil,
+	)
+	if server.UserSettings.Email == nil || server.UserSettings.Tags == nil {
+		t.Fatal("expected the sub-endpoints to be set before the user settings are discovered")
+	}
+	if _, err := server.UserSettings.MetaData(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	data, err := json.Marshal(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a restored server knows the user settings metadata
+	restored, err := RestoreMytokenServer(data)
+	if err != nil {
+		t.Fatalf("could not restore mytoken server: %s", err)
+	}
+	if restored.UserSettings.Email != nil || restored.UserSettings.Tags == nil {
+		t.Errorf(
+			"expected only the tags endpoint to be set, got %v, %v", restored.UserSettings.Email,
+			restored.UserSettings.Tags,
+		)
+	}
+	restored, err = RestoreMytokenServer(data, WithEndpointOverride(EndpointEmailSettings, "https://email.example.com"))
+	if err != nil {
+		t.Fatalf("could not restore mytoken server: %s", err)
+	}
+	if restored.UserSettings.Email == nil {
+		t.Error("expected the overridden email endpoint to be set")
+	}
+}
@@ -0,0 +1,189 @@
+package mytokenlib
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultFileSinkMode is the file mode used for files written by a FileSink if no other mode is configured
+const DefaultFileSinkMode os.FileMode = 0600
+
+// FileOwner describes the owner of a file
+type FileOwner struct {
+	UID int
+	GID int
+}
+
+// FileSinkTarget describes a file that is kept up to date by a FileSink
+type FileSinkTarget struct {
+	// Path is the path of the file
+	Path string
+	// Mode are the permissions of the file; if 0, DefaultFileSinkMode is used
+	Mode os.FileMode
+	// Owner is the owner of the file; if nil, the owner is not changed
+	Owner *FileOwner
+}
+
+// FileSink keeps one or multiple files up to date with fresh access tokens obtained from an AccessTokenSource.
+// Files are written atomically, i.e. readers never observe partially written tokens. Tokens are refreshed ahead of
+// their expiry as configured by the AccessTokenSource's MinValidity. After each update the sink can optionally run a
+// reload command and / or send a signal to a process.
+type FileSink struct {
+	// Files are the files the access token is written to
+	Files []FileSinkTarget
+	// ReloadCommand is a command (name and arguments) that is run after each update
+	ReloadCommand []string
+	// ReloadSignal is a signal that is sent after each update to the process given by ReloadPID or ReloadPIDFile
+	ReloadSignal os.Signal
+	// ReloadPID is the pid of the process that is sent the ReloadSignal
+	ReloadPID int
+	// ReloadPIDFile is the path of a file holding the pid of the process that is sent the ReloadSignal; it is read
+	// before each signal, so it is robust against restarts of the process
+	ReloadPIDFile string
+	// OnError is called with errors that occur while the sink runs in the background
+	OnError func(error)
+
+	source *AccessTokenSource
+}
+
+// NewFileSink creates a new FileSink that writes the access tokens obtained from the passed AccessTokenSource to the
+// passed files
+func NewFileSink(source *AccessTokenSource, files ...FileSinkTarget) *FileSink {
+	return &FileSink{
+		Files:  files,
+		source: source,
+	}
+}
+
+// Update writes a valid access token to all files and performs the configured reload actions
+func (s *FileSink) Update() error {
+	token, _, err := s.source.TokenWithExpiry()
+	if err != nil {
+		return err
+	}
+	return s.write(token)
+}
+
+// Run writes a valid access token to all files and keeps them up to date until the passed context is done. An error
+// is only returned if the initial update fails; errors in later updates are passed to OnError and retried.
+func (s *FileSink) Run(ctx context.Context) error {
+	if err := s.Update(); err != nil {
+		return err
+	}
+	s.keepFresh(ctx)
+	return nil
+}
+
+// keepFresh refreshes the files whenever the current access token is due until the passed context is done
+func (s *FileSink) keepFresh(ctx context.Context) {
+	clock := s.source.clock()
+	timer := clock.NewTimer(s.source.NextRefresh().Sub(clock.Now()))
+	select {
+	case <-ctx.Done():
+		timer.Stop()
+		return
+	case <-timer.C():
+	}
+	s.source.refreshLoop(
+		ctx, func(token string, _ time.Time) error {
+			return s.write(token)
+		}, s.OnError,
+	)
+}
+
+// Remove removes all files of this FileSink
+func (s *FileSink) Remove() error {
+	var firstErr error
+	for _, f := range s.Files {
+		if err := os.Remove(f.Path); err != nil && !os.IsNotExist(err) && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (s *FileSink) write(token string) error {
+	for _, f := range s.Files {
+		mode := f.Mode
+		if mode == 0 {
+			mode = DefaultFileSinkMode
+		}
+		if err := writeFileAtomic(f.Path, []byte(token), mode, f.Owner); err != nil {
+			return err
+		}
+	}
+	return s.reload()
+}
+
+func (s *FileSink) reload() error {
+	if len(s.ReloadCommand) > 0 {
+		if out, err := exec.Command(s.ReloadCommand[0], s.ReloadCommand[1:]...).CombinedOutput(); err != nil {
+			return MytokenError{
+				err:          "reload command failed",
+				errorDetails: strings.TrimSpace(err.Error() + ": " + string(out)),
+			}
+		}
+	}
+	if s.ReloadSignal == nil {
+		return nil
+	}
+	pid := s.ReloadPID
+	if s.ReloadPIDFile != "" {
+		data, err := os.ReadFile(s.ReloadPIDFile)
+		if err != nil {
+			return newMytokenErrorFromError("could not read pid file", err)
+		}
+		if pid, err = strconv.Atoi(strings.TrimSpace(string(data))); err != nil {
+			return newMytokenErrorFromError("could not parse pid file", err)
+		}
+	}
+	if pid <= 0 {
+		return MytokenError{err: "no process to signal"}
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return newMytokenErrorFromError("could not find process to signal", err)
+	}
+	if err = p.Signal(s.ReloadSignal); err != nil {
+		return newMytokenErrorFromError("could not signal process", err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes the passed data to a temporary file in the same directory and renames it to the passed path,
+// so readers never observe a partially written file. If owner is not nil, the ownership of the file is changed.
+func writeFileAtomic(path string, data []byte, perm os.FileMode, owner *FileOwner) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-"+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	if err = f.Chmod(perm); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if owner != nil {
+		if err = f.Chown(owner.UID, owner.GID); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
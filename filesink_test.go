@@ -0,0 +1,175 @@
+package mytokenlib
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read %s: %s", path, err)
+	}
+	return string(data)
+}
+
+func TestFileSinkUpdate(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	var issued atomic.Int32
+	server := newTestMytokenServer(t, accessTokenHandler(600, &issued), nil, WithClock(clock))
+	source := NewAccessTokenSource(server.AccessToken, "mytoken", "", nil, nil, "")
+
+	dir := t.TempDir()
+	first := filepath.Join(dir, "token")
+	second := filepath.Join(dir, "token-group")
+	reloadLog := filepath.Join(dir, "reloads")
+	sink := NewFileSink(
+		source, FileSinkTarget{Path: first}, FileSinkTarget{
+			Path: second,
+			Mode: 0640,
+			// changing the owner to the current user is permitted without privileges
+			Owner: &FileOwner{
+				UID: os.Getuid(),
+				GID: os.Getgid(),
+			},
+		},
+	)
+	// the reload command logs the token that is in the file when it runs
+	sink.ReloadCommand = []string{"sh", "-c", `{ cat "$1"; echo; } >> "$2"`, "sh", first, reloadLog}
+
+	if err := sink.Update(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, f := range []struct {
+		path string
+		mode os.FileMode
+	}{
+		{path: first, mode: DefaultFileSinkMode},
+		{path: second, mode: 0640},
+	} {
+		if token := readTestFile(t, f.path); token != "at1" {
+			t.Errorf("expected %s to contain the access token, got %q", f.path, token)
+		}
+		info, err := os.Stat(f.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != f.mode {
+			t.Errorf("expected %s to have mode %s, got %s", f.path, f.mode, info.Mode().Perm())
+		}
+	}
+
+	// an expired access token is replaced in all files
+	clock.Advance(10 * time.Minute)
+	if err := sink.Update(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if token := readTestFile(t, first); token != "at2" {
+		t.Errorf("expected the rewritten file to contain the new access token, got %q", token)
+	}
+	if token := readTestFile(t, second); token != "at2" {
+		t.Errorf("expected the rewritten file to contain the new access token, got %q", token)
+	}
+	if reloads := readTestFile(t, reloadLog); reloads != "at1\nat2\n" {
+		t.Errorf("expected the reload command to run after each update, got %q", reloads)
+	}
+	// the temporary files used for the atomic writes are cleaned up
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 3 {
+		t.Errorf("expected only the token files and the reload log in the directory, got %v, %v", entries, err)
+	}
+
+	if err := sink.Remove(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, path := range []string{first, second} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed, stat returned: %v", path, err)
+		}
+	}
+}
+
+func TestFileSinkRun(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	var issued atomic.Int32
+	server := newTestMytokenServer(t, accessTokenHandler(600, &issued), nil, WithClock(clock))
+	source := NewAccessTokenSource(server.AccessToken, "mytoken", "", nil, nil, "")
+	path := filepath.Join(t.TempDir(), "token")
+	sink := NewFileSink(source, FileSinkTarget{Path: path})
+	sink.OnError = func(err error) {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- sink.Run(ctx)
+	}()
+	clock.BlockUntilWaiters(1)
+	if token := readTestFile(t, path); token != "at1" {
+		t.Fatalf("expected the file to be written initially, got %q", token)
+	}
+	clock.Advance(source.NextRefresh().Sub(clock.Now()))
+	deadline := time.Now().Add(5 * time.Second)
+	for readTestFile(t, path) != "at2" {
+		if time.Now().After(deadline) {
+			t.Fatal("the file was not refreshed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestFileSinkReloadSignal(t *testing.T) {
+	var issued atomic.Int32
+	server := newTestMytokenServer(t, accessTokenHandler(600, &issued), nil)
+	source := NewAccessTokenSource(server.AccessToken, "mytoken", "", nil, nil, "")
+	dir := t.TempDir()
+	pidFile := filepath.Join(dir, "pid")
+	if err := os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+	defer signal.Stop(signals)
+	sink := NewFileSink(source, FileSinkTarget{Path: filepath.Join(dir, "token")})
+	sink.ReloadSignal = syscall.SIGUSR1
+	sink.ReloadPIDFile = pidFile
+	if err := sink.Update(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	select {
+	case <-signals:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the process in the pid file was not signaled")
+	}
+
+	for _, test := range []struct {
+		name    string
+		pidFile string
+	}{
+		{name: "no process"},
+		{name: "missing pid file", pidFile: filepath.Join(dir, "missing")},
+		{name: "invalid pid file", pidFile: filepath.Join(dir, "token")},
+	} {
+		t.Run(
+			test.name, func(t *testing.T) {
+				sink.ReloadPIDFile = test.pidFile
+				if err := sink.Update(); err == nil {
+					t.Error("expected an error")
+				}
+			},
+		)
+	}
+}
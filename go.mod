@@ -2,6 +2,9 @@ module github.com/oidc-mytoken/lib
 
 go 1.22
 
-require github.com/oidc-mytoken/api v0.12.1
+require (
+	github.com/oidc-mytoken/api v0.12.1
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require github.com/pkg/errors v0.9.1 // indirect
@@ -7,25 +7,31 @@ import (
 // GrantsEndpoint is type representing a mytoken server's grants Endpoint and the actions that can be
 // performed there.
 type GrantsEndpoint struct {
-	endpoint string
+	endpoint *lazyURL
+	client   *client
 	SSH      *SSHGrantEndpoint
 }
 
-func newGrantsEndpoint(endpoint string) *GrantsEndpoint {
+func newGrantsEndpoint(endpoint *lazyURL, c *client) *GrantsEndpoint {
 	return &GrantsEndpoint{
 		endpoint: endpoint,
-		SSH:      newSSHGrantEndpoint(endpoint),
+		client:   c,
+		SSH:      newSSHGrantEndpoint(endpoint, c),
 	}
 }
 
 // DoHTTPRequest performs an http request to the grants endpoint
 func (g GrantsEndpoint) DoHTTPRequest(method string, req, resp interface{}) error {
-	return doHTTPRequest(method, g.endpoint, req, resp)
+	return g.DoHTTPRequestWithAuth(method, req, resp, "")
 }
 
 // DoHTTPRequestWithAuth performs an http request to the grants endpoint
 func (g GrantsEndpoint) DoHTTPRequestWithAuth(method string, req, resp interface{}, mytoken string) error {
-	return doHTTPRequestWithAuth(method, g.endpoint, req, resp, mytoken)
+	url, err := g.endpoint.get()
+	if err != nil {
+		return err
+	}
+	return g.client.doHTTPRequestWithAuth(method, url, req, resp, mytoken)
 }
 
 // APIGet returns the api.GrantTypeInfoResponse about the enabled grant types for this user.
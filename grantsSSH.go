@@ -7,17 +7,14 @@ import (
 // SSHGrantEndpoint is type representing a mytoken server's ssh grant Endpoint and the actions that can be
 // performed there.
 type SSHGrantEndpoint struct {
-	endpoint string
+	endpoint *lazyURL
+	client   *client
 }
 
-func newSSHGrantEndpoint(grantsEndpoint string) *SSHGrantEndpoint {
-	endpoint := grantsEndpoint
-	if endpoint[len(endpoint)-1] != '/' {
-		endpoint += "/"
-	}
-	endpoint += "ssh"
+func newSSHGrantEndpoint(grantsEndpoint *lazyURL, c *client) *SSHGrantEndpoint {
 	return &SSHGrantEndpoint{
-		endpoint: endpoint,
+		endpoint: grantsEndpoint.derive(EndpointSSHGrant, "ssh"),
+		client:   c,
 	}
 }
 
@@ -30,7 +27,14 @@ func (s SSHGrantEndpoint) DoHTTPRequest(method string, req, resp interface{}) er
 func (s SSHGrantEndpoint) DoHTTPRequestWithAuth(
 	method string, req interface{}, resp interface{}, mytoken string,
 ) error {
-	return doHTTPRequestWithAuth(method, s.endpoint, req, resp, mytoken)
+	if err := s.client.requireFeature(FeatureSSH); err != nil {
+		return err
+	}
+	url, err := s.endpoint.get()
+	if err != nil {
+		return err
+	}
+	return s.client.doHTTPRequestWithAuth(method, url, req, resp, mytoken)
 }
 
 // APIGet returns the api.SSHInfoResponse for this user.
@@ -127,11 +131,14 @@ func (s SSHGrantEndpoint) Add(
 func (s SSHGrantEndpoint) APIInitAddSSHKey(
 	mytoken, sshKey, name string, restrictions api.Restrictions, capabilities api.Capabilities,
 ) (resp api.SSHKeyAddResponse, err error) {
+	if err = s.client.validateRestrictionScopes("", restrictions); err != nil {
+		return
+	}
 	req := api.SSHKeyAddRequest{
 		Mytoken:      mytoken,
 		SSHKey:       sshKey,
 		Name:         name,
-		Restrictions: restrictions,
+		Restrictions: s.client.serverTimeRestrictions(restrictions),
 		Capabilities: capabilities,
 		GrantType:    api.GrantTypeMytoken,
 	}
@@ -146,7 +153,7 @@ func (s SSHGrantEndpoint) APIInitAddSSHKey(
 // At the end the api.SSHKeyAddFinalResponse is returned.
 func (s SSHGrantEndpoint) APIPoll(res api.PollingInfo, callback func(int64, int)) (*api.SSHKeyAddFinalResponse, error) {
 	var resp api.SSHKeyAddFinalResponse
-	set, err := poll(res, callback, s, &resp)
+	set, err := poll(s.client.getClock(), res, callback, s, &resp)
 	if err != nil {
 		return nil, err
 	}
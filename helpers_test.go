@@ -0,0 +1,117 @@
+package mytokenlib
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/oidc-mytoken/api/v0"
+)
+
+// testAPIPath is the path below which the endpoints of a test server are served
+const testAPIPath = "/api/v0"
+
+// newTestServer starts an httptest.Server that serves the mytoken server metadata and passes all other requests to
+// the passed handler; modify can adapt the advertised metadata
+func newTestServer(
+	t *testing.T, handler http.HandlerFunc, modify func(*api.MytokenConfiguration),
+) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(nil)
+	srv.Config.Handler = testServerHandler(srv, handler, modify)
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newTestTLSServer is like newTestServer, but starts an httptest.Server with tls; srv.Client() trusts its certificate
+func newTestTLSServer(
+	t *testing.T, handler http.HandlerFunc, modify func(*api.MytokenConfiguration),
+) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(nil)
+	srv.Config.Handler = testServerHandler(srv, handler, modify)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// testServerHandler returns the handler of a test server, see newTestServer
+func testServerHandler(
+	srv *httptest.Server, handler http.HandlerFunc, modify func(*api.MytokenConfiguration),
+) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/.well-known/mytoken-configuration" {
+				handler(w, r)
+				return
+			}
+			base := srv.URL + testAPIPath
+			metadata := api.MytokenConfiguration{
+				Issuer:               srv.URL,
+				AccessTokenEndpoint:  base + "/token/access",
+				MytokenEndpoint:      base + "/token/my",
+				TokeninfoEndpoint:    base + "/tokeninfo",
+				RevocationEndpoint:   base + "/token/revoke",
+				UserSettingsEndpoint: base + "/settings",
+				ProvidersSupported: []api.SupportedProviderConfig{
+					{
+						Issuer:          "https://op.example.com",
+						Name:            "Example",
+						ScopesSupported: []string{"openid", "profile", "storage.read:/"},
+					},
+				},
+			}
+			if modify != nil {
+				modify(&metadata)
+			}
+			writeJSON(w, http.StatusOK, metadata)
+		},
+	)
+}
+
+// newTestMytokenServer starts a test server (see newTestServer) and creates a MytokenServer for it
+func newTestMytokenServer(
+	t *testing.T, handler http.HandlerFunc, modify func(*api.MytokenConfiguration), opts ...Option,
+) *MytokenServer {
+	t.Helper()
+	srv := newTestServer(t, handler, modify)
+	server, err := NewMytokenServerWithOptions(srv.URL, opts...)
+	if err != nil {
+		t.Fatalf("could not create mytoken server: %s", err)
+	}
+	return server
+}
+
+// writeJSON writes the passed value as json response with the passed status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", mimetypeJSON)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// accessTokenHandler returns a handler that issues access tokens "at1", "at2", ... with the passed lifetime in seconds
+// and counts the issued tokens in count
+func accessTokenHandler(expiresIn int64, count *atomic.Int32) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		n := count.Add(1)
+		writeJSON(
+			w, http.StatusOK, api.AccessTokenResponse{
+				AccessToken: fmt.Sprintf("at%d", n),
+				TokenType:   "Bearer",
+				ExpiresIn:   expiresIn,
+			},
+		)
+	}
+}
+
+// roundTripFunc is an http.RoundTripper that calls itself
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip implements the http.RoundTripper interface
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
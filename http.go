@@ -2,8 +2,16 @@ package mytokenlib
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/oidc-mytoken/api/v0"
 )
@@ -17,53 +25,332 @@ const (
 
 const mimetypeJSON = "application/json"
 
-func doHTTPRequest(method, url string, reqBody, responseData interface{}) error {
-	return doHTTPRequestWithAuth(method, url, reqBody, responseData, "")
+// DefaultMaxResponseSize is the maximum size in bytes of a response body if no other size is set with
+// WithMaxResponseSize
+const DefaultMaxResponseSize = 10 << 20
+
+// ErrResponseTooLarge is returned if a response body exceeds the maximum response size, see WithMaxResponseSize. Use
+// errors.Is to check for it.
+var ErrResponseTooLarge = MytokenError{err: "response too large"}
+
+// ErrUnexpectedContentType is returned if a response that should be decoded is not json, e.g. an html error page of a
+// proxy. Use errors.Is to check for it.
+var ErrUnexpectedContentType = MytokenError{err: "unexpected content type"}
+
+// client holds the configuration used for the requests to a mytoken server; the zero value and a nil *client use
+// the package-wide settings from SetClient and SetContext
+type client struct {
+	httpClient        *http.Client
+	userAgent         string
+	ctx               context.Context
+	timeout           time.Duration
+	maxResponseSize   int64
+	logger            *slog.Logger
+	retryPolicy       *RetryPolicy
+	discoveryCache    *DiscoveryCache
+	endpointOverrides map[EndpointName]string
+	urlRewrites       []urlRewrite
+	// skipEndpointValidation disables the validation of advertised endpoint urls against serverURL and
+	// allowedOrigins
+	skipEndpointValidation bool
+	allowedOrigins         []string
+	serverURL              string
+	tls                    *tlsSettings
+	mirrorURLs             []string
+	mirrors                *mirrorSet
+	rateLimit              RateLimit
+	limiter                *rateLimiter
+	breaker                *circuitBreaker
+	// response is the Response the responses are recorded into, see MytokenServer.WithResponse
+	response *Response
+	// strictDecoding and unknownFieldHandler configure how unknown fields in responses are handled
+	strictDecoding      bool
+	unknownFieldHandler func(UnknownField)
+	// metadata is the metadata of the server the requests are sent to, once it is known; it is used to fail fast on
+	// requests the server does not support
+	metadata *api.MytokenConfiguration
+	// settingsMetadata obtains the user settings metadata of the server, which is needed to fail fast on requests
+	// for features that are advertised there
+	settingsMetadata func() (api.SettingsMetaData, error)
+	// resolveIssuerAliases enables the resolution of provider aliases in issuer parameters, see WithIssuerAliases
+	resolveIssuerAliases bool
+	// defaultIssuer is the issuer used for access token requests without an issuer, see WithDefaultIssuer
+	defaultIssuer string
+	// skipVersionCheck disables the check of the advertised api version, see WithVersionCheck
+	skipVersionCheck          bool
+	clockSkew                 *clockSkewEstimate
+	clockSkewWarningThreshold time.Duration
+	clock                     Clock
+}
+
+func (c *client) getHTTPClient() *http.Client {
+	if c != nil && c.httpClient != nil {
+		return c.httpClient
+	}
+	return httpClient
+}
+
+func (c *client) getUserAgent() string {
+	if c != nil && c.userAgent != "" {
+		return c.userAgent
+	}
+	return userAgent
+}
+
+func (c *client) getContext() context.Context {
+	if c != nil && c.ctx != nil {
+		return c.ctx
+	}
+	return ctx
+}
+
+func (c *client) getDiscoveryCache() *DiscoveryCache {
+	if c != nil && c.discoveryCache != nil {
+		return c.discoveryCache
+	}
+	return discoveryCache
+}
+
+func (c *client) getMaxResponseSize() int64 {
+	if c != nil && c.maxResponseSize > 0 {
+		return c.maxResponseSize
+	}
+	return DefaultMaxResponseSize
+}
+
+func (c *client) getRetryPolicy() RetryPolicy {
+	if c != nil && c.retryPolicy != nil {
+		return *c.retryPolicy
+	}
+	return RetryPolicy{MaxAttempts: 1}
+}
+
+// log logs the passed message with the configured logger, if any
+func (c *client) log(level slog.Level, msg string, args ...any) {
+	if c != nil && c.logger != nil {
+		c.logger.Log(c.getContext(), level, msg, args...)
+	}
+}
+
+func (c *client) doHTTPRequest(method, url string, reqBody, responseData interface{}) error {
+	return c.doHTTPRequestWithAuth(method, url, reqBody, responseData, "")
 }
 
-func doHTTPRequestWithAuth(
+func (c *client) doHTTPRequestWithAuth(
 	method, url string, reqBody interface{}, responseData interface{},
 	bearerAuth string,
 ) error {
+	_, err := c.doRequest(method, url, reqBody, responseData, bearerAuth)
+	return err
+}
+
+// doRequest performs an http request and decodes the response into responseData; the returned http.Response gives
+// access to the status and headers, its body is already consumed and closed.
+// Failed requests are retried according to the RetryPolicy and, if mirrors are configured, fail over to the other
+// mirrors (see WithMirrors). Each request gets a request id, which is attached to the returned errors.
+func (c *client) doRequest(
+	method, url string, reqBody interface{}, responseData interface{},
+	bearerAuth string,
+) (*http.Response, error) {
 	b := new(bytes.Buffer)
 	if err := json.NewEncoder(b).Encode(reqBody); err != nil {
-		return newMytokenErrorFromError(errEncodingRequest, err)
-	}
-	req, err := http.NewRequestWithContext(ctx, method, url, b)
-	if err != nil {
-		return newMytokenErrorFromError(errSendingHttpRequest, err)
-	}
-	if userAgent != "" {
-		req.Header.Set("User-Agent", userAgent)
+		return nil, newMytokenErrorFromError(errEncodingRequest, err)
 	}
-	if reqBody != nil {
-		req.Header.Set("Content-Type", mimetypeJSON)
-	}
-	if responseData != nil {
-		req.Header.Set("Accept", mimetypeJSON)
+	r := request{
+		id:          newRequestID(),
+		method:      method,
+		url:         url,
+		body:        b.Bytes(),
+		jsonBody:    reqBody != nil,
+		wantsJSON:   responseData != nil,
+		bearerAuth:  bearerAuth,
+		replayable:  method == http.MethodGet && bearerAuth == "",
+		description: method + " " + url,
 	}
-	if bearerAuth != "" {
-		req.Header.Set("Authorization", "Bearer "+bearerAuth)
+	resp, err := c.sendAndDecode(r, responseData)
+	c.recordResponse(r.id, resp)
+	if err != nil {
+		return resp, withRequestInfo(err, r.id, resp)
 	}
-	resp, err := httpClient.Do(req)
+	return resp, nil
+}
+
+// sendAndDecode sends a request and decodes the response into responseData
+func (c *client) sendAndDecode(r request, responseData interface{}) (*http.Response, error) {
+	resp, body, err := c.sendWithBreaker(r)
 	if err != nil {
-		return newMytokenErrorFromError(errSendingHttpRequest, err)
+		var mytokenErr MytokenError
+		if errors.As(err, &mytokenErr) {
+			// e.g. a public key pin mismatch
+			return nil, mytokenErr
+		}
+		return nil, newMytokenErrorFromError(errSendingHttpRequest, err)
 	}
-	defer resp.Body.Close()
 	if resp.StatusCode >= 400 {
+		if len(body) == 0 {
+			return resp, MytokenError{
+				err:          errDecodingErrorResponse,
+				errorDetails: "empty " + resp.Status + " response",
+			}
+		}
+		if err = checkContentType(resp); err != nil {
+			return resp, err
+		}
 		var apiError api.Error
-		if err = json.NewDecoder(resp.Body).Decode(&apiError); err != nil {
-			return newMytokenErrorFromError(errDecodingErrorResponse, err)
+		if err = json.Unmarshal(body, &apiError); err != nil {
+			return resp, newMytokenErrorFromError(errDecodingErrorResponse, err)
 		}
-		return MytokenError{
+		return resp, MytokenError{
 			err:          apiError.Error,
 			errorDetails: apiError.ErrorDescription,
 		}
 	}
-	if responseData != nil && resp.ContentLength != 0 {
-		if err = json.NewDecoder(resp.Body).Decode(responseData); err != nil {
-			return newMytokenErrorFromError(errDecodingHttpResponse, err)
+	// the body is decoded whenever there is one; its length is only known after reading it, since the
+	// Content-Length header is missing e.g. for chunked responses
+	if responseData != nil && len(bytes.TrimSpace(body)) != 0 {
+		if err = checkContentType(resp); err != nil {
+			return resp, err
+		}
+		if err = c.checkUnknownFields(r.method, r.url, body, responseData); err != nil {
+			return resp, err
+		}
+		if err = json.Unmarshal(body, responseData); err != nil {
+			return resp, c.decodingError(err)
+		}
+	}
+	return resp, nil
+}
+
+// checkContentType checks that the passed response is json; responses without a Content-Type header are assumed to be
+// json
+func checkContentType(resp *http.Response) error {
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil && (mediaType == mimetypeJSON || strings.HasSuffix(mediaType, "+json")) {
+		return nil
+	}
+	return MytokenError{
+		err:          ErrUnexpectedContentType.err,
+		errorDetails: fmt.Sprintf("%s response with content type '%s'", resp.Status, contentType),
+	}
+}
+
+// request describes a single request to a mytoken server
+type request struct {
+	id         string
+	method     string
+	url        string
+	body       []byte
+	jsonBody   bool
+	wantsJSON  bool
+	bearerAuth string
+	// replayable tells if the request can be sent again after an unclear failure; this is only the case for requests
+	// that do not use a mytoken, since using a mytoken might rotate it
+	replayable  bool
+	description string
+}
+
+// sendWithRetries sends a request and retries it according to the RetryPolicy
+func (c *client) sendWithRetries(r request) (*http.Response, []byte, error) {
+	policy := c.getRetryPolicy()
+	for attempt := 1; ; attempt++ {
+		resp, body, err := c.send(r)
+		if attempt >= policy.MaxAttempts || !policy.shouldRetry(r, resp, err) {
+			return resp, body, err
+		}
+		backoff := policy.backoff(attempt)
+		c.log(
+			slog.LevelWarn, "retrying mytoken request", "request", r.description, "request_id", r.id, "attempt", attempt,
+			"backoff", backoff, "reason", failureReason(resp, err),
+		)
+		if !c.sleep(backoff) {
+			return nil, nil, c.getContext().Err()
+		}
+	}
+}
+
+// failureReason returns the reason why a request failed for logging
+func failureReason(resp *http.Response, err error) any {
+	if err != nil {
+		return err
+	}
+	return resp.Status
+}
+
+// send sends a single request and reads the response body
+func (c *client) send(r request) (*http.Response, []byte, error) {
+	if c != nil && c.limiter != nil {
+		if err := c.limiter.wait(c.getContext(), c, r); err != nil {
+			return nil, nil, err
 		}
 	}
-	return nil
+	reqCtx := c.getContext()
+	if c != nil && c.timeout > 0 {
+		var cancel context.CancelFunc
+		reqCtx, cancel = context.WithTimeout(reqCtx, c.timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(reqCtx, r.method, r.url, bytes.NewReader(r.body))
+	if err != nil {
+		return nil, nil, err
+	}
+	if ua := c.getUserAgent(); ua != "" {
+		req.Header.Set("User-Agent", ua)
+	}
+	if r.jsonBody {
+		req.Header.Set("Content-Type", mimetypeJSON)
+	}
+	if r.wantsJSON {
+		req.Header.Set("Accept", mimetypeJSON)
+	}
+	if r.bearerAuth != "" {
+		req.Header.Set("Authorization", "Bearer "+r.bearerAuth)
+	}
+	if r.id != "" {
+		req.Header.Set(RequestIDHeader, r.id)
+	}
+	start := c.getClock().Now()
+	resp, err := c.getHTTPClient().Do(req)
+	if err != nil {
+		c.log(
+			slog.LevelDebug, "mytoken request failed", "request", r.description, "request_id", r.id, "error", err,
+		)
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	c.observeClockSkew(resp, start, c.getClock().Now())
+	if c != nil && c.limiter != nil {
+		c.limiter.observe(resp, c.getClockSkew())
+	}
+	body, err := readBody(resp, c.getMaxResponseSize())
+	c.log(
+		slog.LevelDebug, "mytoken request", "request", r.description, "request_id", r.id, "status", resp.StatusCode,
+		"duration", c.getClock().Now().Sub(start),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, body, nil
+}
+
+// readBody reads the body of the passed response, but at most maxSize bytes
+func readBody(resp *http.Response, maxSize int64) ([]byte, error) {
+	tooLarge := MytokenError{
+		err:          ErrResponseTooLarge.err,
+		errorDetails: fmt.Sprintf("the response body exceeds the maximum size of %d bytes", maxSize),
+	}
+	if resp.ContentLength > maxSize {
+		return nil, tooLarge
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxSize {
+		return nil, tooLarge
+	}
+	return body, nil
 }
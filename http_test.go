@@ -0,0 +1,178 @@
+package mytokenlib
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/oidc-mytoken/api/v0"
+)
+
+func TestMaxResponseSize(t *testing.T) {
+	const maxSize = 100
+	tests := []struct {
+		name     string
+		status   int
+		size     int
+		chunked  bool
+		tooLarge bool
+	}{
+		{
+			name:   "small",
+			status: http.StatusOK,
+			size:   20,
+		},
+		{
+			name:   "at the limit",
+			status: http.StatusOK,
+			size:   maxSize,
+		},
+		{
+			name:     "content length above the limit",
+			status:   http.StatusOK,
+			size:     maxSize + 1,
+			tooLarge: true,
+		},
+		{
+			name:     "chunked above the limit",
+			status:   http.StatusOK,
+			size:     maxSize + 1,
+			chunked:  true,
+			tooLarge: true,
+		},
+		{
+			name:     "error response above the limit",
+			status:   http.StatusBadGateway,
+			size:     10 * maxSize,
+			tooLarge: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				srv := httptest.NewServer(
+					http.HandlerFunc(
+						func(w http.ResponseWriter, r *http.Request) {
+							// a json object with the requested size
+							body := `{"error":"` + strings.Repeat("a", test.size-12) + `"}`
+							w.Header().Set("Content-Type", mimetypeJSON)
+							if !test.chunked {
+								w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+							}
+							w.WriteHeader(test.status)
+							if test.chunked {
+								// flushing before the body is written sends it without Content-Length
+								w.(http.Flusher).Flush()
+							}
+							_, _ = w.Write([]byte(body))
+						},
+					),
+				)
+				t.Cleanup(srv.Close)
+				c, err := newClient([]Option{WithMaxResponseSize(maxSize)})
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = c.doRequest(http.MethodGet, srv.URL, nil, &api.Error{}, "")
+				if test.tooLarge {
+					if !errors.Is(err, ErrResponseTooLarge) {
+						t.Errorf("expected ErrResponseTooLarge, got %v", err)
+					}
+					return
+				}
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+			},
+		)
+	}
+	if _, err := newClient([]Option{WithMaxResponseSize(0)}); err == nil {
+		t.Error("expected a maximum response size of 0 to be rejected")
+	}
+}
+
+func TestResponseContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		// expected is the expected error, if any; ErrUnexpectedContentType or an error with the passed text
+		expected error
+	}{
+		{
+			name:        "json",
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body:        `{"access_token":"at"}`,
+		},
+		{
+			name:   "no content type",
+			status: http.StatusOK,
+			body:   `{"access_token":"at"}`,
+		},
+		{
+			name:        "json error",
+			status:      http.StatusBadRequest,
+			contentType: "application/problem+json",
+			body:        `{"error":"invalid_request"}`,
+			expected:    MytokenError{err: "invalid_request"},
+		},
+		{
+			name:        "html",
+			status:      http.StatusOK,
+			contentType: "text/html",
+			body:        "<html><body>login</body></html>",
+			expected:    ErrUnexpectedContentType,
+		},
+		{
+			name:        "html error page of a proxy",
+			status:      http.StatusBadGateway,
+			contentType: "text/html; charset=utf-8",
+			body:        "<html><body>502 Bad Gateway</body></html>",
+			expected:    ErrUnexpectedContentType,
+		},
+		{
+			name:        "empty body",
+			status:      http.StatusOK,
+			contentType: "text/plain",
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				srv := httptest.NewServer(
+					http.HandlerFunc(
+						func(w http.ResponseWriter, r *http.Request) {
+							w.Header().Set("Content-Type", test.contentType)
+							w.WriteHeader(test.status)
+							_, _ = w.Write([]byte(test.body))
+						},
+					),
+				)
+				t.Cleanup(srv.Close)
+				var resp api.AccessTokenResponse
+				_, err := (&client{}).doRequest(http.MethodGet, srv.URL, nil, &resp, "")
+				if test.expected == nil {
+					if err != nil {
+						t.Fatalf("unexpected error: %s", err)
+					}
+					if test.body != "" && resp.AccessToken != "at" {
+						t.Errorf("expected the response to be decoded, got %+v", resp)
+					}
+					return
+				}
+				if !errors.Is(err, test.expected) {
+					t.Fatalf("expected %v, got %v", test.expected, err)
+				}
+				var mytokenErr MytokenError
+				if errors.As(err, &mytokenErr) && mytokenErr.StatusCode() != test.status {
+					t.Errorf("expected the status code %d, got %d", test.status, mytokenErr.StatusCode())
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,121 @@
+package mytokenlib
+
+import (
+	"sync"
+)
+
+// ErrUnsupportedByServer is returned if an endpoint or feature is not supported by the mytoken server. Use errors.Is
+// to check for it.
+var ErrUnsupportedByServer = MytokenError{err: "unsupported by server"}
+
+// errEndpointUnsupported returns an error matching ErrUnsupportedByServer for the passed endpoint name
+func errEndpointUnsupported(name string) error {
+	return errUnsupported(name + " endpoint")
+}
+
+// lazyURL is the url of an endpoint that is only resolved when it is first needed, e.g. because it requires a
+// discovery request. The resolved url is the advertised url; the url that is used is obtained from it as described
+// for client.endpointURL, so overrides and rewrite rules also apply, and it is validated (see WithEndpointValidation).
+// If the endpoint is overridden, it is not resolved at all. A successfully resolved url is cached; a failed resolution
+// is retried on the next use. It is safe for concurrent use.
+type lazyURL struct {
+	name    EndpointName
+	client  *client
+	resolve func() (string, error)
+	// parent and path are set for urls that are derived from another endpoint's url
+	parent *lazyURL
+	path   string
+
+	mutex    sync.Mutex
+	url      string
+	resolved bool
+}
+
+func newLazyURL(name EndpointName, c *client, resolve func() (string, error)) *lazyURL {
+	return &lazyURL{
+		name:    name,
+		client:  c,
+		resolve: resolve,
+	}
+}
+
+// newAdvertisedURL returns a lazyURL for an endpoint whose url is advertised in the server metadata; if the server
+// does not advertise it, it resolves to an error matching ErrUnsupportedByServer
+func newAdvertisedURL(name EndpointName, c *client, advertised string) *lazyURL {
+	return newLazyURL(
+		name, c, func() (string, error) {
+			if advertised == "" {
+				return "", errEndpointUnsupported(string(name))
+			}
+			return advertised, nil
+		},
+	)
+}
+
+// advertised returns the url as advertised by the server
+func (u *lazyURL) advertised() (string, error) {
+	if u.parent == nil {
+		return u.resolve()
+	}
+	base, err := u.parent.advertised()
+	if err != nil {
+		return "", err
+	}
+	return joinURLPath(base, u.path), nil
+}
+
+// overridden checks if this url or one it is derived from is overridden
+func (u *lazyURL) overridden() bool {
+	if _, ok := u.client.override(u.name); ok {
+		return true
+	}
+	return u.parent != nil && u.parent.overridden()
+}
+
+// get returns the url, resolving it if needed
+func (u *lazyURL) get() (string, error) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if u.resolved {
+		return u.url, nil
+	}
+	var url string
+	var err error
+	if override, ok := u.client.override(u.name); ok {
+		url = override
+	} else if u.parent != nil && u.parent.overridden() {
+		url, err = u.parent.get()
+		url = joinURLPath(url, u.path)
+	} else if url, err = u.advertised(); err == nil {
+		url = u.client.rewriteURL(url)
+		err = u.client.validateEndpointURL(u.name, url)
+	}
+	if err != nil {
+		return "", err
+	}
+	u.url = url
+	u.resolved = true
+	return url, nil
+}
+
+// derive returns a new lazyURL for the endpoint with the passed name that is resolved by appending the passed path to
+// this url
+func (u *lazyURL) derive(name EndpointName, path string) *lazyURL {
+	return &lazyURL{
+		name:   name,
+		client: u.client,
+		parent: u,
+		path:   path,
+	}
+}
+
+// joinURLPath appends the passed path to the passed url
+func joinURLPath(url, path string) string {
+	if url == "" {
+		return ""
+	}
+	if url[len(url)-1] != '/' {
+		url += "/"
+	}
+	return url + path
+}
@@ -0,0 +1,191 @@
+package mytokenlib
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mirrorRecheckInterval is the duration after which a mirror that failed is tried in its regular order again
+const mirrorRecheckInterval = time.Minute
+
+// WithMirrors configures additional base urls under which the same mytoken server is reachable, e.g. independent
+// entry points of a deployment. The url passed when creating the MytokenServer is the primary url; endpoint urls
+// below it are also reachable below each mirror url.
+// Requests are sent to the mirror that answered the last request successfully; if it cannot be reached, the request
+// fails over to the next mirror. Mirrors that failed recently are tried last. Requests that use a mytoken only fail
+// over if they did not reach the server, i.e. if the connection could not be established, so that a request that
+// might have rotated the mytoken is never sent again; see RetryPolicy for the details. The health of the mirrors can
+// be obtained with MytokenServer.Mirrors.
+func WithMirrors(urls ...string) Option {
+	return func(c *client) error {
+		for _, u := range urls {
+			if !isAbsoluteURL(u) {
+				return MytokenError{
+					err:          "invalid mirror",
+					errorDetails: "'" + u + "' is not an absolute url",
+				}
+			}
+		}
+		c.mirrorURLs = append(c.mirrorURLs, urls...)
+		return nil
+	}
+}
+
+// MirrorStatus describes the health of a mirror of a mytoken server, see WithMirrors
+type MirrorStatus struct {
+	// URL is the base url of the mirror
+	URL string
+	// Healthy tells if the last request to the mirror succeeded; mirrors that were not used yet are healthy
+	Healthy bool
+	// Preferred tells if requests are currently sent to this mirror first
+	Preferred bool
+	// LastError is the error of the last failed request to the mirror
+	LastError error
+	// LastFailure is the time of the last failed request to the mirror
+	LastFailure time.Time
+	// LastSuccess is the time of the last successful request to the mirror
+	LastSuccess time.Time
+}
+
+// Mirrors returns the health of the server's base urls, starting with the primary url; if no mirrors are configured
+// (see WithMirrors), nil is returned
+func (s *MytokenServer) Mirrors() []MirrorStatus {
+	if s.client == nil || s.client.mirrors == nil {
+		return nil
+	}
+	return s.client.mirrors.status()
+}
+
+// mirrorSet tracks the health of the base urls of a mytoken server; it is safe for concurrent use
+type mirrorSet struct {
+	clock     Clock
+	mutex     sync.Mutex
+	mirrors   []MirrorStatus
+	preferred int
+}
+
+// setServerURL sets the url of the server the requests are sent to and sets up the configured mirrors for it
+func (c *client) setServerURL(url string) {
+	c.serverURL = url
+	if len(c.mirrorURLs) > 0 && c.mirrors == nil {
+		c.mirrors = newMirrorSet(url, c.mirrorURLs, c.getClock())
+	}
+}
+
+func newMirrorSet(primary string, mirrors []string, clock Clock) *mirrorSet {
+	set := &mirrorSet{clock: clock}
+	for _, u := range append([]string{primary}, mirrors...) {
+		set.mirrors = append(
+			set.mirrors, MirrorStatus{
+				URL:     strings.TrimSuffix(u, "/"),
+				Healthy: true,
+			},
+		)
+	}
+	return set
+}
+
+func (m *mirrorSet) status() []MirrorStatus {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	status := make([]MirrorStatus, len(m.mirrors))
+	copy(status, m.mirrors)
+	status[m.preferred].Preferred = true
+	return status
+}
+
+// mirrorTarget is a url of a request on a specific mirror
+type mirrorTarget struct {
+	mirror int
+	url    string
+}
+
+// targets returns the urls of the passed url on all mirrors in the order they should be tried; if the url is not
+// below the primary url, only the url itself is returned
+func (m *mirrorSet) targets(url string) []mirrorTarget {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	primary := m.mirrors[0].URL
+	path, ok := strings.CutPrefix(url, primary)
+	if !ok || (path != "" && path[0] != '/' && path[0] != '?') {
+		return []mirrorTarget{{-1, url}}
+	}
+	// start with the preferred mirror and keep the configured order for the others
+	order := []int{m.preferred}
+	for i := range m.mirrors {
+		if i != m.preferred {
+			order = append(order, i)
+		}
+	}
+	var healthy, unhealthy []mirrorTarget
+	for _, index := range order {
+		mirror := m.mirrors[index]
+		t := mirrorTarget{index, mirror.URL + path}
+		if !mirror.Healthy && m.clock.Now().Sub(mirror.LastFailure) < mirrorRecheckInterval {
+			unhealthy = append(unhealthy, t)
+		} else {
+			healthy = append(healthy, t)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+// report records the result of a request to the passed mirror
+func (m *mirrorSet) report(mirror int, failed bool, err error) {
+	if mirror < 0 {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	status := &m.mirrors[mirror]
+	if failed {
+		status.Healthy = false
+		status.LastError = err
+		status.LastFailure = m.clock.Now()
+		return
+	}
+	status.Healthy = true
+	status.LastSuccess = m.clock.Now()
+	m.preferred = mirror
+}
+
+// sendWithFailover sends a request (see sendWithRetries) to the preferred mirror and fails over to the other mirrors
+// as long as the request can be sent again
+func (c *client) sendWithFailover(r request) (*http.Response, []byte, error) {
+	if c == nil || c.mirrors == nil {
+		return c.sendWithRetries(r)
+	}
+	targets := c.mirrors.targets(r.url)
+	var resp *http.Response
+	var body []byte
+	var err error
+	for i, t := range targets {
+		r.url = t.url
+		resp, body, err = c.sendWithRetries(r)
+		failed := err != nil ||
+			(resp.StatusCode >= http.StatusBadGateway && resp.StatusCode <= http.StatusGatewayTimeout)
+		reportedErr := err
+		if reportedErr == nil && failed {
+			reportedErr = MytokenError{
+				err:          errSendingHttpRequest,
+				errorDetails: resp.Status,
+			}
+		}
+		if c.getContext().Err() != nil {
+			// the request was cancelled, which says nothing about the mirror
+			break
+		}
+		c.mirrors.report(t.mirror, failed, reportedErr)
+		if !failed || i == len(targets)-1 || !canResend(r, resp, err) {
+			break
+		}
+		c.log(
+			slog.LevelWarn, "failing over to mirror", "request", r.description, "mirror", targets[i+1].url,
+			"reason", failureReason(resp, err),
+		)
+	}
+	return resp, body, err
+}
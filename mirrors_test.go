@@ -0,0 +1,147 @@
+package mytokenlib
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/oidc-mytoken/api/v0"
+)
+
+func TestFailover(t *testing.T) {
+	requests := []struct {
+		name       string
+		method     string
+		body       any
+		bearer     string
+		replayable bool
+	}{
+		{
+			name:       "get",
+			method:     http.MethodGet,
+			replayable: true,
+		},
+		{
+			name:   "get with bearer token",
+			method: http.MethodGet,
+			bearer: "mytoken",
+		},
+		{
+			name:   "post with bearer token",
+			method: http.MethodPost,
+			body:   api.NotificationAddTokenRequest{},
+			bearer: "mytoken",
+		},
+		{
+			name:   "post with mytoken",
+			method: http.MethodPost,
+			body:   api.AccessTokenRequest{Mytoken: "mytoken"},
+		},
+	}
+	failures := []string{"unavailable", "dropped connection", "connection refused"}
+	for _, req := range requests {
+		for _, failure := range failures {
+			t.Run(
+				req.name+"/"+failure, func(t *testing.T) {
+					var primaryHits, mirrorHits atomic.Int32
+					primary := httptest.NewServer(
+						http.HandlerFunc(
+							func(w http.ResponseWriter, r *http.Request) {
+								primaryHits.Add(1)
+								if failure == "dropped connection" {
+									conn, _, _ := w.(http.Hijacker).Hijack()
+									_ = conn.Close()
+									return
+								}
+								writeJSON(w, http.StatusServiceUnavailable, api.Error{Error: "unavailable"})
+							},
+						),
+					)
+					t.Cleanup(primary.Close)
+					if failure == "connection refused" {
+						primary.Close()
+					}
+					mirror := httptest.NewServer(
+						http.HandlerFunc(
+							func(w http.ResponseWriter, r *http.Request) {
+								mirrorHits.Add(1)
+								writeJSON(w, http.StatusOK, map[string]string{})
+							},
+						),
+					)
+					t.Cleanup(mirror.Close)
+
+					c, err := newClient([]Option{WithMirrors(mirror.URL), WithRetryPolicy(RetryPolicy{MaxAttempts: 2})})
+					if err != nil {
+						t.Fatal(err)
+					}
+					c.setServerURL(primary.URL)
+					var resp map[string]string
+					_, err = c.doRequest(req.method, primary.URL+testAPIPath+"/test", req.body, &resp, req.bearer)
+
+					failover := req.replayable || failure == "connection refused"
+					expectedPrimaryHits := int32(1)
+					if req.replayable {
+						expectedPrimaryHits = 2
+					}
+					if failure == "connection refused" {
+						expectedPrimaryHits = 0
+					}
+					if n := primaryHits.Load(); n != expectedPrimaryHits {
+						t.Errorf("expected %d requests to the primary server, got %d", expectedPrimaryHits, n)
+					}
+					if !failover {
+						if err == nil {
+							t.Error("expected an error")
+						}
+						if n := mirrorHits.Load(); n != 0 {
+							t.Errorf("expected the request not to be sent to the mirror, got %d requests", n)
+						}
+						return
+					}
+					if err != nil {
+						t.Fatalf("expected the request to fail over, got %s", err)
+					}
+					if n := mirrorHits.Load(); n != 1 {
+						t.Errorf("expected one request to the mirror, got %d", n)
+					}
+					status := c.mirrors.status()
+					if status[0].Healthy || !status[1].Healthy || !status[1].Preferred {
+						t.Errorf("expected the mirror to be preferred over the failed primary server, got %+v", status)
+					}
+				},
+			)
+		}
+	}
+}
+
+func TestMirrorsOfMytokenServer(t *testing.T) {
+	primary := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadGateway)
+			},
+		),
+	)
+	t.Cleanup(primary.Close)
+	var count atomic.Int32
+	mirror := httptest.NewServer(testServerHandler(primary, accessTokenHandler(300, &count), nil))
+	t.Cleanup(mirror.Close)
+
+	server, err := NewMytokenServerWithOptions(primary.URL, WithMirrors(mirror.URL))
+	if err != nil {
+		t.Fatalf("expected the discovery to fail over to the mirror, got %s", err)
+	}
+	status := server.Mirrors()
+	if len(status) != 2 || status[0].Healthy || status[0].LastError == nil || !status[1].Preferred {
+		t.Fatalf("expected the mirror to be preferred after the failed discovery, got %+v", status)
+	}
+	// the preferred mirror is tried first, so a request using a mytoken reaches it without failing over
+	if _, err = server.AccessToken.APIGet("mytoken", "", nil, nil, ""); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n := count.Load(); n != 1 {
+		t.Errorf("expected one access token request to the mirror, got %d", n)
+	}
+}
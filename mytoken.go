@@ -7,23 +7,35 @@ import (
 // MytokenEndpoint is type representing a mytoken server's Mytoken Endpoint and the actions that can be
 // performed there.
 type MytokenEndpoint struct {
-	endpoint string
+	endpoint     string
+	tagsEndpoint string
+	client       *client
 }
 
-func newMytokenEndpoint(endpoint string) *MytokenEndpoint {
+func newMytokenEndpoint(endpoint, tagsEndpoint string, c *client) *MytokenEndpoint {
 	return &MytokenEndpoint{
-		endpoint: endpoint,
+		endpoint:     endpoint,
+		tagsEndpoint: tagsEndpoint,
+		client:       c,
 	}
 }
 
 // DoHTTPRequest performs an http request to the mytoken endpoint
 func (my MytokenEndpoint) DoHTTPRequest(method string, req, resp interface{}) error {
-	return doHTTPRequest(method, my.endpoint, req, resp)
+	return my.client.doHTTPRequest(method, my.endpoint, req, resp)
 }
 
 // APIFromRequest sends the passed request marshalled as json to the servers mytoken endpoint to obtain a mytoken and
 // returns the api.MytokenResponse.
-func (my MytokenEndpoint) APIFromRequest(request interface{}) (resp api.MytokenResponse, err error) {
+// If the request is an api.GeneralMytokenRequest or an api.MytokenFromMytokenRequest (or a pointer to one), the nbf
+// and exp claims of its restrictions are converted to the server's clock (see MytokenServer.ServerTime) without
+// modifying the passed request; other requests are sent unmodified.
+func (my MytokenEndpoint) APIFromRequest(request interface{}) (api.MytokenResponse, error) {
+	return my.fromRequest(my.client.serverTimeRequest(request))
+}
+
+// fromRequest sends the passed request unmodified to the mytoken endpoint
+func (my MytokenEndpoint) fromRequest(request interface{}) (resp api.MytokenResponse, err error) {
 	err = my.DoHTTPRequest("POST", request, &resp)
 	return
 }
@@ -43,16 +55,30 @@ func (my MytokenEndpoint) FromRequest(request interface{}) (string, *string, err
 }
 
 // APIFromMytoken obtains a sub-mytoken by using an existing mytoken according to the passed parameters.
+// The issuer can also be a provider alias if enabled with WithIssuerAliases.
 // If the used mytoken changes (due to token rotation), the new mytoken is included in the api.MytokenResponse
 func (my MytokenEndpoint) APIFromMytoken(
 	mytoken string, issuer string, restrictions api.Restrictions, capabilities api.Capabilities, rotation *api.Rotation,
 	responseType, name string,
 ) (api.MytokenResponse, error) {
+	if err := my.client.requireGrantType(EndpointMytoken, api.GrantTypeMytoken); err != nil {
+		return api.MytokenResponse{}, err
+	}
+	if err := my.client.requireResponseType(responseType); err != nil {
+		return api.MytokenResponse{}, err
+	}
+	issuer, err := my.client.resolveIssuer(issuer)
+	if err != nil {
+		return api.MytokenResponse{}, err
+	}
+	if err = my.client.validateRestrictionScopes(issuer, restrictions); err != nil {
+		return api.MytokenResponse{}, err
+	}
 	req := api.MytokenFromMytokenRequest{
 		GeneralMytokenRequest: api.GeneralMytokenRequest{
 			Issuer:       issuer,
 			GrantType:    api.GrantTypeMytoken,
-			Restrictions: restrictions,
+			Restrictions: my.client.serverTimeRestrictions(restrictions),
 			Capabilities: capabilities,
 			Rotation:     rotation,
 			Name:         name,
@@ -60,7 +86,7 @@ func (my MytokenEndpoint) APIFromMytoken(
 		},
 		Mytoken: mytoken,
 	}
-	return my.APIFromRequest(req)
+	return my.fromRequest(req)
 }
 
 // FromMytoken obtains a sub-mytoken by using an existing mytoken according to the passed parameters.
@@ -81,11 +107,14 @@ func (my MytokenEndpoint) FromMytoken(
 
 // APIFromTransferCode exchanges the transferCode into the linked mytoken
 func (my MytokenEndpoint) APIFromTransferCode(transferCode string) (api.MytokenResponse, error) {
+	if err := my.client.requireGrantType(EndpointMytoken, api.GrantTypeTransferCode); err != nil {
+		return api.MytokenResponse{}, err
+	}
 	req := api.ExchangeTransferCodeRequest{
 		GrantType:    api.GrantTypeTransferCode,
 		TransferCode: transferCode,
 	}
-	return my.APIFromRequest(req)
+	return my.fromRequest(req)
 }
 
 // FromTransferCode exchanges the transferCode into the linked mytoken
@@ -149,11 +178,27 @@ func (my MytokenEndpoint) FromAuthorizationFlow(
 }
 
 // APIInitAuthorizationFlow starts the authorization code flow to obtain a mytoken with the passed parameters; it
-// returns the api.AuthCodeFlowResponse
+// returns the api.AuthCodeFlowResponse. The issuer can also be a provider alias if enabled with WithIssuerAliases.
 func (my MytokenEndpoint) APIInitAuthorizationFlow(req api.GeneralMytokenRequest) (
 	resp api.AuthCodeFlowResponse, err error,
 ) {
+	if err = my.client.requireGrantType(EndpointMytoken, api.GrantTypeOIDCFlow); err != nil {
+		return
+	}
+	if err = my.client.requireOIDCFlow(api.OIDCFlowAuthorizationCode); err != nil {
+		return
+	}
+	if err = my.client.requireResponseType(req.ResponseType); err != nil {
+		return
+	}
+	if req.Issuer, err = my.client.resolveIssuer(req.Issuer); err != nil {
+		return
+	}
+	if err = my.client.validateRestrictionScopes(req.Issuer, req.Restrictions); err != nil {
+		return
+	}
 	req.GrantType = api.GrantTypeOIDCFlow
+	req.Restrictions = my.client.serverTimeRestrictions(req.Restrictions)
 	flowReq := api.AuthCodeFlowRequest{
 		OIDCFlowRequest: api.OIDCFlowRequest{
 			GeneralMytokenRequest: req,
@@ -173,7 +218,7 @@ func (my MytokenEndpoint) APIInitAuthorizationFlow(req api.GeneralMytokenRequest
 // At the end the api.MytokenResponse is returned.
 func (my MytokenEndpoint) APIPoll(res api.PollingInfo, callback func(int64, int)) (*api.MytokenResponse, error) {
 	var resp api.MytokenResponse
-	set, err := poll(res, callback, my, &resp)
+	set, err := poll(my.client.getClock(), res, callback, my, &resp)
 	if err != nil {
 		return nil, err
 	}
@@ -227,15 +272,22 @@ func (my MytokenEndpoint) PollOnce(pollingCode string) (string, bool, error) {
 // MytokenTagsEndpoint is a type representing the Mytoken Tags sub-endpoint
 type MytokenTagsEndpoint struct {
 	endpoint string
+	client   *client
 }
 
-func newMytokenTagsEndpoint(endpoint string) *MytokenTagsEndpoint {
-	return &MytokenTagsEndpoint{endpoint: endpoint}
+func newMytokenTagsEndpoint(endpoint string, c *client) *MytokenTagsEndpoint {
+	return &MytokenTagsEndpoint{
+		endpoint: endpoint,
+		client:   c,
+	}
 }
 
 // APIAdd adds a tag to a mytoken
 func (t MytokenTagsEndpoint) APIAdd(mytoken api.AddTagToMytokenRequest) (resp api.OnlyTokenUpdateResponse, err error) {
-	err = doHTTPRequest("POST", t.endpoint, mytoken, &resp)
+	if err = t.client.requireFeature(FeatureTags, EndpointMytokenTags); err != nil {
+		return
+	}
+	err = t.client.doHTTPRequest("POST", t.endpoint, mytoken, &resp)
 	return
 }
 
@@ -243,11 +295,14 @@ func (t MytokenTagsEndpoint) APIAdd(mytoken api.AddTagToMytokenRequest) (resp ap
 func (t MytokenTagsEndpoint) APIRemove(mytoken api.RemoveTagFromMytokenRequest) (
 	resp api.OnlyTokenUpdateResponse, err error,
 ) {
-	err = doHTTPRequest("DELETE", t.endpoint, mytoken, &resp)
+	if err = t.client.requireFeature(FeatureTags, EndpointMytokenTags); err != nil {
+		return
+	}
+	err = t.client.doHTTPRequest("DELETE", t.endpoint, mytoken, &resp)
 	return
 }
 
 // Tags returns the tags sub-endpoint for the mytoken endpoint
 func (my MytokenEndpoint) Tags() *MytokenTagsEndpoint {
-	return newMytokenTagsEndpoint(my.endpoint + "/tags")
+	return newMytokenTagsEndpoint(my.tagsEndpoint, my.client)
 }
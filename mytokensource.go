@@ -0,0 +1,321 @@
+package mytokenlib
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// EnvCredentialsDirectory is the environment variable systemd sets to the directory holding a service's credentials
+const EnvCredentialsDirectory = "CREDENTIALS_DIRECTORY"
+
+// ErrNoMytoken is returned by a MytokenSource that does not provide a mytoken, e.g. because an environment variable
+// is not set or a file does not exist. Use errors.Is to check for it.
+var ErrNoMytoken = MytokenError{err: "no mytoken found"}
+
+// MytokenSource is an interface for types that supply a mytoken
+type MytokenSource interface {
+	// Mytoken returns the mytoken; if this source does not provide a mytoken an error matching ErrNoMytoken is
+	// returned
+	Mytoken() (string, error)
+	// Name returns a short description of this source, e.g. "env:MYTOKEN"
+	Name() string
+}
+
+// MytokenStore is implemented by MytokenSources that can replace the mytoken they supply, e.g. with the new mytoken
+// after the mytoken was rotated
+type MytokenStore interface {
+	// StoreMytoken stores the passed mytoken, so that it is supplied by subsequent calls to Mytoken
+	StoreMytoken(mytoken string) error
+}
+
+// EnvMytokenSource is a MytokenSource that reads the mytoken from an environment variable
+type EnvMytokenSource struct {
+	Variable string
+}
+
+// Mytoken implements the MytokenSource interface
+func (s EnvMytokenSource) Mytoken() (string, error) {
+	if t := strings.TrimSpace(os.Getenv(s.Variable)); t != "" {
+		return t, nil
+	}
+	return "", MytokenError{
+		err:          ErrNoMytoken.err,
+		errorDetails: "environment variable '" + s.Variable + "' not set",
+	}
+}
+
+// Name implements the MytokenSource interface
+func (s EnvMytokenSource) Name() string {
+	return "env:" + s.Variable
+}
+
+// FileMytokenSource is a MytokenSource that reads the mytoken from a file
+type FileMytokenSource struct {
+	Path string
+}
+
+// Mytoken implements the MytokenSource interface
+func (s FileMytokenSource) Mytoken() (string, error) {
+	return readMytokenFile(s.Path)
+}
+
+// Name implements the MytokenSource interface
+func (s FileMytokenSource) Name() string {
+	return "file:" + s.Path
+}
+
+// StoreMytoken implements the MytokenStore interface; the file is replaced atomically and keeps its permissions
+func (s FileMytokenSource) StoreMytoken(mytoken string) error {
+	perm := os.FileMode(0600)
+	if info, err := os.Stat(s.Path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	if err := writeFileAtomic(s.Path, []byte(mytoken+"\n"), perm, nil); err != nil {
+		return newMytokenErrorFromError("could not store mytoken", err)
+	}
+	return nil
+}
+
+// CredentialMytokenSource is a MytokenSource that reads the mytoken from a systemd credential, i.e. from the file
+// with the name Credential in $CREDENTIALS_DIRECTORY
+type CredentialMytokenSource struct {
+	Credential string
+}
+
+// Mytoken implements the MytokenSource interface
+func (s CredentialMytokenSource) Mytoken() (string, error) {
+	dir := os.Getenv(EnvCredentialsDirectory)
+	if dir == "" {
+		return "", MytokenError{
+			err:          ErrNoMytoken.err,
+			errorDetails: "environment variable '" + EnvCredentialsDirectory + "' not set",
+		}
+	}
+	return readMytokenFile(filepath.Join(dir, s.Credential))
+}
+
+// Name implements the MytokenSource interface
+func (s CredentialMytokenSource) Name() string {
+	return "credential:" + s.Credential
+}
+
+// CommandMytokenSource is a MytokenSource that runs a command and uses its output as the mytoken
+type CommandMytokenSource struct {
+	Command string
+	Args    []string
+}
+
+// Mytoken implements the MytokenSource interface
+func (s CommandMytokenSource) Mytoken() (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(s.Command, s.Args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", MytokenError{
+			err:          "mytoken command failed",
+			errorDetails: strings.TrimSpace(err.Error() + ": " + stderr.String()),
+		}
+	}
+	if t := strings.TrimSpace(string(out)); t != "" {
+		return t, nil
+	}
+	return "", MytokenError{
+		err:          ErrNoMytoken.err,
+		errorDetails: "command '" + s.Command + "' did not print a mytoken",
+	}
+}
+
+// Name implements the MytokenSource interface
+func (s CommandMytokenSource) Name() string {
+	return "cmd:" + strings.Join(append([]string{s.Command}, s.Args...), " ")
+}
+
+// ReaderMytokenSource is a MytokenSource that reads the mytoken from an io.Reader, e.g. stdin. The reader is only
+// read once, afterwards the same mytoken is returned.
+type ReaderMytokenSource struct {
+	reader io.Reader
+	name   string
+
+	once    sync.Once
+	mytoken string
+	err     error
+}
+
+// NewReaderMytokenSource creates a new ReaderMytokenSource reading from the passed io.Reader and described by the
+// passed name
+func NewReaderMytokenSource(reader io.Reader, name string) *ReaderMytokenSource {
+	return &ReaderMytokenSource{
+		reader: reader,
+		name:   name,
+	}
+}
+
+// NewStdinMytokenSource creates a new ReaderMytokenSource reading from stdin
+func NewStdinMytokenSource() *ReaderMytokenSource {
+	return NewReaderMytokenSource(os.Stdin, "stdin")
+}
+
+// Mytoken implements the MytokenSource interface
+func (s *ReaderMytokenSource) Mytoken() (string, error) {
+	s.once.Do(
+		func() {
+			data, err := io.ReadAll(s.reader)
+			if err != nil {
+				s.err = newMytokenErrorFromError("could not read mytoken", err)
+				return
+			}
+			s.mytoken = strings.TrimSpace(string(data))
+			if s.mytoken == "" {
+				s.err = MytokenError{
+					err:          ErrNoMytoken.err,
+					errorDetails: s.name + " is empty",
+				}
+			}
+		},
+	)
+	return s.mytoken, s.err
+}
+
+// Name implements the MytokenSource interface
+func (s *ReaderMytokenSource) Name() string {
+	return s.name
+}
+
+// MytokenSourceChain is a MytokenSource that tries multiple MytokenSources in order and returns the mytoken from
+// the first one that provides a mytoken. Sources that do not provide a mytoken are skipped, any other error is
+// returned immediately.
+type MytokenSourceChain []MytokenSource
+
+// Mytoken implements the MytokenSource interface
+func (c MytokenSourceChain) Mytoken() (string, error) {
+	t, _, err := c.MytokenWithSource()
+	return t, err
+}
+
+// MytokenWithSource returns the mytoken together with the MytokenSource that supplied it
+func (c MytokenSourceChain) MytokenWithSource() (string, MytokenSource, error) {
+	for _, s := range c {
+		if chain, ok := s.(MytokenSourceChain); ok {
+			t, source, err := chain.MytokenWithSource()
+			if err == nil || !errors.Is(err, ErrNoMytoken) {
+				return t, source, err
+			}
+			continue
+		}
+		t, err := s.Mytoken()
+		if err == nil {
+			return t, s, nil
+		}
+		if !errors.Is(err, ErrNoMytoken) {
+			return "", s, err
+		}
+	}
+	return "", nil, MytokenError{
+		err:          ErrNoMytoken.err,
+		errorDetails: "tried " + c.Name(),
+	}
+}
+
+// Name implements the MytokenSource interface
+func (c MytokenSourceChain) Name() string {
+	names := make([]string, len(c))
+	for i, s := range c {
+		names[i] = s.Name()
+	}
+	return strings.Join(names, ", ")
+}
+
+// DefaultMytokenSources returns a MytokenSourceChain with commonly used sources: the MYTOKEN environment variable,
+// the file named by the MYTOKEN_FILE environment variable, and the systemd credential "mytoken"
+func DefaultMytokenSources() MytokenSourceChain {
+	chain := MytokenSourceChain{EnvMytokenSource{Variable: "MYTOKEN"}}
+	if f := os.Getenv("MYTOKEN_FILE"); f != "" {
+		chain = append(chain, FileMytokenSource{Path: f})
+	}
+	return append(chain, CredentialMytokenSource{Credential: "mytoken"})
+}
+
+// ParseMytokenSource parses a MytokenSource from a string specification. The following specifications are supported:
+//   - "env:<VARIABLE>" for an EnvMytokenSource
+//   - "file:<path>" for a FileMytokenSource
+//   - "credential:<name>" for a CredentialMytokenSource
+//   - "cmd:<command> [args...]" for a CommandMytokenSource; the command line is split at white space
+//   - "stdin" or "-" for reading from stdin
+//
+// Multiple specifications can be separated by "|" to create a MytokenSourceChain.
+func ParseMytokenSource(spec string) (MytokenSource, error) {
+	if parts := strings.Split(spec, "|"); len(parts) > 1 {
+		chain := make(MytokenSourceChain, len(parts))
+		for i, p := range parts {
+			s, err := ParseMytokenSource(p)
+			if err != nil {
+				return nil, err
+			}
+			chain[i] = s
+		}
+		return chain, nil
+	}
+	spec = strings.TrimSpace(spec)
+	if spec == "stdin" || spec == "-" {
+		return NewStdinMytokenSource(), nil
+	}
+	kind, value, found := strings.Cut(spec, ":")
+	if !found || value == "" {
+		return nil, MytokenError{
+			err:          "invalid mytoken source",
+			errorDetails: spec,
+		}
+	}
+	switch kind {
+	case "env":
+		return EnvMytokenSource{Variable: value}, nil
+	case "file":
+		return FileMytokenSource{Path: value}, nil
+	case "credential":
+		return CredentialMytokenSource{Credential: value}, nil
+	case "cmd":
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			return nil, MytokenError{
+				err:          "invalid mytoken source",
+				errorDetails: "'" + spec + "' does not contain a command",
+			}
+		}
+		return CommandMytokenSource{
+			Command: fields[0],
+			Args:    fields[1:],
+		}, nil
+	default:
+		return nil, MytokenError{
+			err:          "invalid mytoken source",
+			errorDetails: "unknown source type '" + kind + "'",
+		}
+	}
+}
+
+func readMytokenFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", MytokenError{
+				err:          ErrNoMytoken.err,
+				errorDetails: "file '" + path + "' does not exist",
+			}
+		}
+		return "", newMytokenErrorFromError("could not read mytoken file", err)
+	}
+	if t := strings.TrimSpace(string(data)); t != "" {
+		return t, nil
+	}
+	return "", MytokenError{
+		err:          ErrNoMytoken.err,
+		errorDetails: "file '" + path + "' is empty",
+	}
+}
@@ -0,0 +1,45 @@
+package mytokenlib
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMytokenSource(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected MytokenSource
+	}{
+		{spec: "env:MYTOKEN", expected: EnvMytokenSource{Variable: "MYTOKEN"}},
+		{spec: " file:/tmp/mt ", expected: FileMytokenSource{Path: "/tmp/mt"}},
+		{
+			spec:     "cmd:pass show mytoken",
+			expected: CommandMytokenSource{Command: "pass", Args: []string{"show", "mytoken"}},
+		},
+		{
+			spec: "env:MYTOKEN|stdin",
+			expected: MytokenSourceChain{
+				EnvMytokenSource{Variable: "MYTOKEN"},
+				NewStdinMytokenSource(),
+			},
+		},
+	}
+	for _, test := range tests {
+		source, err := ParseMytokenSource(test.spec)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", test.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(source, test.expected) {
+			t.Errorf("%q: expected %#v, got %#v", test.spec, test.expected, source)
+		}
+	}
+}
+
+func TestParseMytokenSourceInvalid(t *testing.T) {
+	for _, spec := range []string{"", "env", "env:", "cmd:", "cmd:   ", "unknown:value", "env:MYTOKEN|cmd: "} {
+		if _, err := ParseMytokenSource(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
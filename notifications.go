@@ -6,21 +6,37 @@ import (
 
 // NotificationsEndpoint is type representing a mytoken server's Notifications Endpoint
 type NotificationsEndpoint struct {
-	endpoint string
+	endpoint *lazyURL
+	client   *client
 }
 
-func newNotificationsEndpoint(endpoint string) *NotificationsEndpoint {
-	return &NotificationsEndpoint{endpoint: endpoint}
+func newNotificationsEndpoint(endpoint *lazyURL, c *client) *NotificationsEndpoint {
+	return &NotificationsEndpoint{
+		endpoint: endpoint,
+		client:   c,
+	}
 }
 
 // DoHTTPRequest performs an http request to the notifications endpoint
 func (n NotificationsEndpoint) DoHTTPRequest(method string, req, resp interface{}) error {
-	return doHTTPRequest(method, n.endpoint, req, resp)
+	return n.DoHTTPRequestWithAuth(method, req, resp, "")
 }
 
 // DoHTTPRequestWithAuth performs an http request to the notifications endpoint with mytoken authorization
 func (n NotificationsEndpoint) DoHTTPRequestWithAuth(method string, req, resp interface{}, mytoken string) error {
-	return doHTTPRequestWithAuth(method, n.endpoint, req, resp, mytoken)
+	return n.doHTTPRequestWithAuthAt("", method, req, resp, mytoken)
+}
+
+// doHTTPRequestWithAuthAt performs an http request to the passed path below the notifications endpoint with mytoken
+// authorization
+func (n NotificationsEndpoint) doHTTPRequestWithAuthAt(
+	path, method string, req, resp interface{}, mytoken string,
+) error {
+	url, err := n.endpoint.get()
+	if err != nil {
+		return err
+	}
+	return n.client.doHTTPRequestWithAuth(method, url+path, req, resp, mytoken)
 }
 
 // APIList lists all notifications
@@ -37,28 +53,24 @@ func (n NotificationsEndpoint) APICreate(mytoken string, req api.SubscribeNotifi
 
 // APIUpdate updates notification classes and/or tags
 func (n NotificationsEndpoint) APIUpdate(mytoken, managementCode string, req api.NotificationUpdateRequest) (resp api.OnlyTokenUpdateResponse, err error) {
-	url := n.endpoint + "/" + managementCode + "/nc"
-	err = doHTTPRequestWithAuth("PUT", url, req, &resp, mytoken)
+	err = n.doHTTPRequestWithAuthAt("/"+managementCode+"/nc", "PUT", req, &resp, mytoken)
 	return
 }
 
 // APIDelete deletes a notification by management code
 func (n NotificationsEndpoint) APIDelete(mytoken, managementCode string) (resp api.OnlyTokenUpdateResponse, err error) {
-	url := n.endpoint + "/" + managementCode
-	err = doHTTPRequestWithAuth("DELETE", url, nil, &resp, mytoken)
+	err = n.doHTTPRequestWithAuthAt("/"+managementCode, "DELETE", nil, &resp, mytoken)
 	return
 }
 
 // APIAddToken adds a token to a notification
 func (n NotificationsEndpoint) APIAddToken(mytoken, managementCode string, req api.NotificationAddTokenRequest) (resp api.OnlyTokenUpdateResponse, err error) {
-	url := n.endpoint + "/" + managementCode + "/token"
-	err = doHTTPRequestWithAuth("POST", url, req, &resp, mytoken)
+	err = n.doHTTPRequestWithAuthAt("/"+managementCode+"/token", "POST", req, &resp, mytoken)
 	return
 }
 
 // APIRemoveToken removes a token from a notification
 func (n NotificationsEndpoint) APIRemoveToken(mytoken, managementCode string, req api.NotificationRemoveTokenRequest) (resp api.OnlyTokenUpdateResponse, err error) {
-	url := n.endpoint + "/" + managementCode + "/token"
-	err = doHTTPRequestWithAuth("DELETE", url, req, &resp, mytoken)
+	err = n.doHTTPRequestWithAuthAt("/"+managementCode+"/token", "DELETE", req, &resp, mytoken)
 	return
 }
@@ -0,0 +1,254 @@
+package mytokenlib
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Option is an option for a MytokenServer, see NewMytokenServerWithOptions.
+// Settings that are not configured through options fall back to the package-wide settings (see SetClient,
+// SetContext, and SetDiscoveryCache).
+type Option func(*client) error
+
+// EndpointName is the name of a mytoken server endpoint, e.g. used to override its url
+type EndpointName string
+
+// EndpointNames of the endpoints advertised in the server metadata
+const (
+	EndpointAccessToken   EndpointName = "access_token"
+	EndpointMytoken       EndpointName = "mytoken"
+	EndpointRevocation    EndpointName = "revocation"
+	EndpointTokeninfo     EndpointName = "tokeninfo"
+	EndpointTransfer      EndpointName = "token_transfer"
+	EndpointUserSettings  EndpointName = "usersettings"
+	EndpointNotifications EndpointName = "notifications"
+	EndpointProfiles      EndpointName = "profiles"
+)
+
+// EndpointNames of the endpoints advertised in the user settings metadata
+const (
+	EndpointGrants        EndpointName = "grants"
+	EndpointEmailSettings EndpointName = "email"
+	EndpointTagsSettings  EndpointName = "tags"
+)
+
+// EndpointNames of the endpoints whose urls are derived from another endpoint's url
+const (
+	// EndpointCalendars is derived from EndpointNotifications
+	EndpointCalendars EndpointName = "calendars"
+	// EndpointSSHGrant is derived from EndpointGrants
+	EndpointSSHGrant EndpointName = "ssh"
+	// EndpointMytokenTags is derived from EndpointMytoken
+	EndpointMytokenTags EndpointName = "mytoken_tags"
+)
+
+// NewMytokenServerWithOptions creates a new MytokenServer that is configured by the passed options
+func NewMytokenServerWithOptions(url string, opts ...Option) (*MytokenServer, error) {
+	c, err := newClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	return newMytokenServer(url, c)
+}
+
+func newClient(opts []Option) (*client, error) {
+	c := &client{}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.applyTLSSettings(); err != nil {
+		return nil, err
+	}
+	c.limiter = newRateLimiter(c.rateLimit, c.getClock())
+	if c.breaker != nil {
+		c.breaker.clock = c.getClock()
+	}
+	c.clockSkew = &clockSkewEstimate{}
+	return c, nil
+}
+
+// WithHTTPClient sets the http.Client used for the requests
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *client) error {
+		c.httpClient = httpClient
+		return nil
+	}
+}
+
+// WithUserAgent sets the user agent sent with the requests
+func WithUserAgent(userAgent string) Option {
+	return func(c *client) error {
+		c.userAgent = userAgent
+		return nil
+	}
+}
+
+// WithContext sets the context.Context used for the requests
+func WithContext(ctx context.Context) Option {
+	return func(c *client) error {
+		c.ctx = ctx
+		return nil
+	}
+}
+
+// WithTimeout sets the timeout for a single request, including reading the response
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *client) error {
+		c.timeout = timeout
+		return nil
+	}
+}
+
+// WithMaxResponseSize sets the maximum size in bytes of a response body; requests whose responses are larger fail
+// with an error matching ErrResponseTooLarge. By default, DefaultMaxResponseSize is used.
+func WithMaxResponseSize(size int64) Option {
+	return func(c *client) error {
+		if size <= 0 {
+			return MytokenError{
+				err:          "invalid maximum response size",
+				errorDetails: "the size must be positive",
+			}
+		}
+		c.maxResponseSize = size
+		return nil
+	}
+}
+
+// WithLogger sets a logger; requests are logged at debug level, retries at warn level
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *client) error {
+		c.logger = logger
+		return nil
+	}
+}
+
+// WithRetryPolicy sets the RetryPolicy for failed requests; by default requests are not retried
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *client) error {
+		c.retryPolicy = &policy
+		return nil
+	}
+}
+
+// WithDiscoveryCache sets the DiscoveryCache used for the discovery
+func WithDiscoveryCache(cache *DiscoveryCache) Option {
+	return func(c *client) error {
+		c.discoveryCache = cache
+		return nil
+	}
+}
+
+// WithDiscoveryCacheDir sets up a DiscoveryCache in the passed directory for the discovery
+func WithDiscoveryCacheDir(dir string) Option {
+	return WithDiscoveryCache(NewDiscoveryCache(dir))
+}
+
+// WithEndpointOverride overrides the url of the passed endpoint, i.e. the passed url is used instead of the one
+// advertised by the server. Endpoints whose urls are derived from the overridden endpoint (e.g. EndpointCalendars from
+// EndpointNotifications) are derived from the override, unless they are overridden themselves. Overrides take
+// precedence over rewrite rules (see WithURLRewrite).
+func WithEndpointOverride(endpoint EndpointName, endpointURL string) Option {
+	return func(c *client) error {
+		if !isAbsoluteURL(endpointURL) {
+			return MytokenError{
+				err:          "invalid endpoint override",
+				errorDetails: string(endpoint) + ": '" + endpointURL + "' is not an absolute url",
+			}
+		}
+		if c.endpointOverrides == nil {
+			c.endpointOverrides = map[EndpointName]string{}
+		}
+		c.endpointOverrides[endpoint] = endpointURL
+		return nil
+	}
+}
+
+// WithURLRewrite adds a rewrite rule for the endpoint urls advertised by the server, including the urls derived from
+// them: urls starting with the prefix from are rewritten to start with the prefix to instead, e.g. to reach a server
+// that advertises its public urls on an internal host and path prefix. If multiple rules match a url, the rule that
+// was added first is applied.
+func WithURLRewrite(from, to string) Option {
+	return func(c *client) error {
+		for _, u := range []string{from, to} {
+			if !isAbsoluteURL(u) {
+				return MytokenError{
+					err:          "invalid url rewrite",
+					errorDetails: "'" + u + "' is not an absolute url",
+				}
+			}
+		}
+		c.urlRewrites = append(
+			c.urlRewrites, urlRewrite{
+				from: from,
+				to:   to,
+			},
+		)
+		return nil
+	}
+}
+
+// urlRewrite is a rewrite rule for endpoint urls, see WithURLRewrite
+type urlRewrite struct {
+	from string
+	to   string
+}
+
+func isAbsoluteURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
+// override returns the override for the passed endpoint, if there is one
+func (c *client) override(endpoint EndpointName) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	u, ok := c.endpointOverrides[endpoint]
+	return u, ok
+}
+
+// available checks if the passed endpoint can be used, i.e. if it is advertised by the server or overridden
+func (c *client) available(endpoint EndpointName, advertised string) bool {
+	_, overridden := c.override(endpoint)
+	return advertised != "" || overridden
+}
+
+// rewriteURL applies the first matching rewrite rule to the passed url
+func (c *client) rewriteURL(u string) string {
+	if c == nil || u == "" {
+		return u
+	}
+	for _, r := range c.urlRewrites {
+		if rest, ok := strings.CutPrefix(u, r.from); ok {
+			return r.to + rest
+		}
+	}
+	return u
+}
+
+// endpointURL returns the url that is used for the passed endpoint, i.e. the override if there is one, otherwise the
+// advertised url with the rewrite rules applied
+func (c *client) endpointURL(endpoint EndpointName, advertised string) string {
+	if u, ok := c.override(endpoint); ok {
+		return u
+	}
+	return c.rewriteURL(advertised)
+}
+
+// derivedEndpointURL returns the url that is used for the passed endpoint, whose url is derived by appending path to
+// the url of the parent endpoint; see also lazyURL
+func (c *client) derivedEndpointURL(endpoint, parent EndpointName, advertisedParent, path string) string {
+	if u, ok := c.override(endpoint); ok {
+		return u
+	}
+	if u, ok := c.override(parent); ok {
+		return joinURLPath(u, path)
+	}
+	return c.rewriteURL(joinURLPath(advertisedParent, path))
+}
@@ -0,0 +1,161 @@
+package mytokenlib
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/oidc-mytoken/api/v0"
+)
+
+func TestMytokenServerOptions(t *testing.T) {
+	var userAgent atomic.Value
+	srv := newTestServer(
+		t, func(w http.ResponseWriter, r *http.Request) {
+			userAgent.Store(r.UserAgent())
+			if r.URL.Query().Get("slow") != "" {
+				time.Sleep(200 * time.Millisecond)
+			}
+			writeJSON(w, http.StatusOK, api.AccessTokenResponse{AccessToken: "at"})
+		}, nil,
+	)
+	var sent atomic.Int32
+	httpClient := &http.Client{
+		Transport: roundTripFunc(
+			func(r *http.Request) (*http.Response, error) {
+				sent.Add(1)
+				return http.DefaultTransport.RoundTrip(r)
+			},
+		),
+	}
+	server, err := NewMytokenServerWithOptions(
+		srv.URL, WithHTTPClient(httpClient), WithUserAgent("options-test"), WithTimeout(50*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("could not create mytoken server: %s", err)
+	}
+	if _, err = server.AccessToken.APIGet("mytoken", "", nil, nil, ""); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n := sent.Load(); n != 2 {
+		t.Errorf("expected the discovery and the request to be sent with the passed http client, got %d requests", n)
+	}
+	if ua := userAgent.Load(); ua != "options-test" {
+		t.Errorf("expected the passed user agent, got %q", ua)
+	}
+	server.AccessToken.endpoint += "?slow=1"
+	if _, err = server.AccessToken.APIGet("mytoken", "", nil, nil, ""); err == nil {
+		t.Error("expected the request to time out")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = NewMytokenServerWithOptions(srv.URL, WithContext(ctx)); err == nil {
+		t.Error("expected the discovery to fail with a canceled context")
+	}
+}
+
+func TestInvalidOptions(t *testing.T) {
+	options := map[string]Option{
+		"relative override":       WithEndpointOverride(EndpointMytoken, "/api/v0/token/my"),
+		"relative rewrite source": WithURLRewrite("/api", "https://mytoken.example.com/api"),
+		"relative rewrite target": WithURLRewrite("https://mytoken.example.com/api", "/api"),
+	}
+	for name, option := range options {
+		if _, err := newClient([]Option{option}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestEndpointRewritesAndOverrides(t *testing.T) {
+	const (
+		internal = "https://internal.example.com/api"
+		public   = "https://public.example.com/mytoken/api"
+	)
+	advertiseInternal := func(metadata *api.MytokenConfiguration) {
+		metadata.AccessTokenEndpoint = internal + "/v0/token/access"
+		metadata.MytokenEndpoint = internal + "/v0/token/my"
+		metadata.TokeninfoEndpoint = internal + "/v0/tokeninfo"
+		metadata.RevocationEndpoint = internal + "/v0/token/revoke"
+		metadata.UserSettingsEndpoint = internal + "/v0/settings"
+		metadata.NotificationsEndpoint = internal + "/v0/notifications"
+	}
+	srv := newTestServer(
+		t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}, advertiseInternal,
+	)
+	tests := []struct {
+		name              string
+		opts              []Option
+		expectedMytoken   string
+		expectedTags      string
+		expectedCalendars string
+	}{
+		{
+			name:              "rewrite",
+			opts:              []Option{WithURLRewrite(internal, public)},
+			expectedMytoken:   public + "/v0/token/my",
+			expectedTags:      public + "/v0/token/my/tags",
+			expectedCalendars: public + "/v0/notifications/calendars",
+		},
+		{
+			name: "first matching rewrite",
+			opts: []Option{
+				WithURLRewrite(internal+"/v0/token/", "https://tokens.example.com/"),
+				WithURLRewrite(internal, public),
+			},
+			expectedMytoken:   "https://tokens.example.com/my",
+			expectedTags:      "https://tokens.example.com/my/tags",
+			expectedCalendars: public + "/v0/notifications/calendars",
+		},
+		{
+			name: "overridden parent",
+			opts: []Option{
+				WithURLRewrite(internal, public),
+				WithEndpointOverride(EndpointMytoken, "https://other.example.com/my"),
+				WithEndpointOverride(EndpointNotifications, "https://other.example.com/notifications"),
+			},
+			expectedMytoken:   "https://other.example.com/my",
+			expectedTags:      "https://other.example.com/my/tags",
+			expectedCalendars: "https://other.example.com/notifications/calendars",
+		},
+		{
+			name: "overridden derived endpoint",
+			opts: []Option{
+				WithURLRewrite(internal, public),
+				WithEndpointOverride(EndpointMytokenTags, "https://other.example.com/tags"),
+				WithEndpointOverride(EndpointCalendars, "https://other.example.com/calendars"),
+			},
+			expectedMytoken:   public + "/v0/token/my",
+			expectedTags:      "https://other.example.com/tags",
+			expectedCalendars: "https://other.example.com/calendars",
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				server, err := NewMytokenServerWithOptions(srv.URL, test.opts...)
+				if err != nil {
+					t.Fatalf("could not create mytoken server: %s", err)
+				}
+				if server.Mytoken.endpoint != test.expectedMytoken {
+					t.Errorf("expected the mytoken endpoint %q, got %q", test.expectedMytoken, server.Mytoken.endpoint)
+				}
+				if server.Mytoken.tagsEndpoint != test.expectedTags {
+					t.Errorf("expected the tags endpoint %q, got %q", test.expectedTags, server.Mytoken.tagsEndpoint)
+				}
+				calendars, err := server.Calendars.endpoint.get()
+				if err != nil {
+					t.Fatalf("could not resolve the calendars endpoint: %s", err)
+				}
+				if calendars != test.expectedCalendars {
+					t.Errorf("expected the calendars endpoint %q, got %q", test.expectedCalendars, calendars)
+				}
+			},
+		)
+	}
+}
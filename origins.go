@@ -0,0 +1,167 @@
+package mytokenlib
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/oidc-mytoken/api/v0"
+)
+
+// ErrInvalidEndpoint is returned if an endpoint url advertised by the server is rejected by the endpoint validation,
+// see WithEndpointValidation. Use errors.Is to check for it.
+var ErrInvalidEndpoint = MytokenError{err: "invalid endpoint"}
+
+// WithEndpointValidation enables or disables the validation of the endpoint urls advertised by the server; it is
+// enabled by default. An advertised endpoint is rejected if its origin (scheme, host and port) differs from the
+// origin of the server url, or if it uses plain http with a host other than localhost. Origins passed to
+// WithAllowedOrigins and the targets of rewrite rules (see WithURLRewrite) are accepted in addition; endpoints that
+// are overridden with WithEndpointOverride are not validated.
+func WithEndpointValidation(enabled bool) Option {
+	return func(c *client) error {
+		c.skipEndpointValidation = !enabled
+		return nil
+	}
+}
+
+// WithAllowedOrigins adds origins, e.g. "https://mytoken.example.com:8443", that are accepted for advertised
+// endpoints in addition to the server's origin, e.g. for deployments that serve endpoints from multiple hosts. An
+// explicitly allowed origin may use plain http.
+func WithAllowedOrigins(origins ...string) Option {
+	return func(c *client) error {
+		for _, o := range origins {
+			normalized, err := origin(o)
+			if err != nil {
+				return MytokenError{
+					err:          "invalid allowed origin",
+					errorDetails: "'" + o + "' is not an absolute url",
+				}
+			}
+			c.allowedOrigins = append(c.allowedOrigins, normalized)
+		}
+		return nil
+	}
+}
+
+// origin returns the normalised origin of the passed url, i.e. the lower-cased scheme and host with the port only
+// included if it is not the scheme's default port
+func origin(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("'%s' is not an absolute url", rawURL)
+	}
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if (scheme == "https" && port == "443") || (scheme == "http" && port == "80") {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	return scheme + "://" + host, nil
+}
+
+func isLocalhost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// validateEndpointURL checks if the passed url of the passed endpoint is acceptable, see WithEndpointValidation
+func (c *client) validateEndpointURL(endpoint EndpointName, endpointURL string) error {
+	if c == nil || c.skipEndpointValidation || endpointURL == "" {
+		return nil
+	}
+	invalid := func(details string) error {
+		return MytokenError{
+			err:          ErrInvalidEndpoint.err,
+			errorDetails: string(endpoint) + " endpoint '" + endpointURL + "' " + details,
+		}
+	}
+	o, err := origin(endpointURL)
+	if err != nil {
+		return invalid("is not an absolute url")
+	}
+	// explicitly allowed origins and rewrite targets are configured by the user and therefore trusted, even with
+	// plain http
+	for _, allowed := range c.allowedOrigins {
+		if o == allowed {
+			return nil
+		}
+	}
+	for _, r := range c.urlRewrites {
+		if target, err := origin(r.to); err == nil && o == target {
+			return nil
+		}
+	}
+	serverOrigin, err := origin(c.serverURL)
+	if err != nil || o != serverOrigin {
+		return invalid("has a different origin than the server '" + c.serverURL + "'")
+	}
+	if u, _ := url.Parse(endpointURL); strings.EqualFold(u.Scheme, "http") && !isLocalhost(u.Hostname()) {
+		return invalid("uses plain http")
+	}
+	return nil
+}
+
+// validateEndpoints validates the urls of all endpoints advertised in the passed api.MytokenConfiguration, see
+// WithEndpointValidation
+func (c *client) validateEndpoints(metadata api.MytokenConfiguration) error {
+	endpoints := []struct {
+		name EndpointName
+		url  string
+	}{
+		{EndpointAccessToken, metadata.AccessTokenEndpoint},
+		{EndpointMytoken, metadata.MytokenEndpoint},
+		{EndpointRevocation, metadata.RevocationEndpoint},
+		{EndpointTokeninfo, metadata.TokeninfoEndpoint},
+		{EndpointTransfer, metadata.TokenTransferEndpoint},
+		{EndpointUserSettings, metadata.UserSettingsEndpoint},
+		{EndpointNotifications, metadata.NotificationsEndpoint},
+		{EndpointProfiles, metadata.ProfilesEndpoint},
+	}
+	for _, e := range endpoints {
+		if _, overridden := c.override(e.name); overridden {
+			continue
+		}
+		if err := c.validateEndpointURL(e.name, c.endpointURL(e.name, e.url)); err != nil {
+			return err
+		}
+	}
+	derived := []struct {
+		name, parent EndpointName
+		parentURL    string
+		path         string
+	}{
+		{
+			EndpointMytokenTags, EndpointMytoken, metadata.MytokenEndpoint,
+			derivedPath(EndpointMytokenTags, metadata),
+		},
+		{
+			EndpointCalendars, EndpointNotifications, metadata.NotificationsEndpoint,
+			derivedPath(EndpointCalendars, metadata),
+		},
+	}
+	for _, e := range derived {
+		_, overridden := c.override(e.name)
+		_, parentOverridden := c.override(e.parent)
+		if overridden || parentOverridden {
+			continue
+		}
+		endpointURL := c.derivedEndpointURL(e.name, e.parent, e.parentURL, e.path)
+		if err := c.validateEndpointURL(e.name, endpointURL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package mytokenlib
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/oidc-mytoken/api/v0"
+)
+
+func TestEndpointValidationOnByDefault(t *testing.T) {
+	srv := newTestTLSServer(
+		t, nil, func(metadata *api.MytokenConfiguration) {
+			metadata.AccessTokenEndpoint = "https://other.example.com/api/v0/token/access"
+		},
+	)
+	_, err := NewMytokenServerWithOptions(srv.URL, WithHTTPClient(srv.Client()))
+	if !errors.Is(err, ErrInvalidEndpoint) {
+		t.Fatalf("expected ErrInvalidEndpoint, got %v", err)
+	}
+	if _, err = NewMytokenServerWithOptions(
+		srv.URL, WithHTTPClient(srv.Client()), WithEndpointValidation(false),
+	); err != nil {
+		t.Errorf("expected no error with disabled endpoint validation, got %s", err)
+	}
+	if _, err = NewMytokenServerWithOptions(
+		srv.URL, WithHTTPClient(srv.Client()), WithAllowedOrigins("https://OTHER.example.com:443"),
+	); err != nil {
+		t.Errorf("expected no error for an allowed origin, got %s", err)
+	}
+	if _, err = NewMytokenServerWithOptions(
+		srv.URL, WithHTTPClient(srv.Client()),
+		WithEndpointOverride(EndpointAccessToken, "https://other.example.com/api/v0/token/access"),
+	); err != nil {
+		t.Errorf("expected an overridden endpoint not to be validated, got %s", err)
+	}
+}
+
+func TestValidateEndpointURL(t *testing.T) {
+	tests := []struct {
+		name        string
+		serverURL   string
+		endpointURL string
+		opts        []Option
+		valid       bool
+	}{
+		{
+			name:        "same origin",
+			serverURL:   "https://mytoken.example.com",
+			endpointURL: "https://mytoken.example.com/api/v0/token/my",
+			valid:       true,
+		},
+		{
+			name:        "default port",
+			serverURL:   "https://mytoken.example.com",
+			endpointURL: "https://MYTOKEN.example.com:443/api/v0/token/my",
+			valid:       true,
+		},
+		{
+			name:        "other port",
+			serverURL:   "https://mytoken.example.com",
+			endpointURL: "https://mytoken.example.com:8443/api/v0/token/my",
+		},
+		{
+			name:        "other host",
+			serverURL:   "https://mytoken.example.com",
+			endpointURL: "https://attacker.example.com/api/v0/token/my",
+		},
+		{
+			name:        "downgrade to http",
+			serverURL:   "https://mytoken.example.com",
+			endpointURL: "http://mytoken.example.com/api/v0/token/my",
+		},
+		{
+			name:        "plain http",
+			serverURL:   "http://mytoken.example.com",
+			endpointURL: "http://mytoken.example.com/api/v0/token/my",
+		},
+		{
+			name:        "plain http on localhost",
+			serverURL:   "http://localhost:8000",
+			endpointURL: "http://localhost:8000/api/v0/token/my",
+			valid:       true,
+		},
+		{
+			name:        "plain http on loopback ip",
+			serverURL:   "http://127.0.0.1:8000",
+			endpointURL: "http://127.0.0.1:8000/api/v0/token/my",
+			valid:       true,
+		},
+		{
+			name:        "plain http on ipv6 loopback",
+			serverURL:   "http://[::1]:8000",
+			endpointURL: "http://[::1]:8000/api/v0/token/my",
+			valid:       true,
+		},
+		{
+			name:        "explicitly allowed plain http",
+			serverURL:   "https://mytoken.example.com",
+			endpointURL: "http://internal.example.com/api/v0/token/my",
+			opts:        []Option{WithAllowedOrigins("http://internal.example.com")},
+			valid:       true,
+		},
+		{
+			name:        "rewrite target",
+			serverURL:   "https://mytoken.example.com",
+			endpointURL: "https://public.example.com/mytoken/api/v0/token/my",
+			opts: []Option{
+				WithURLRewrite("https://internal.example.com/api", "https://public.example.com/mytoken/api"),
+			},
+			valid: true,
+		},
+		{
+			name:        "relative url",
+			serverURL:   "https://mytoken.example.com",
+			endpointURL: "/api/v0/token/my",
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				c, err := newClient(test.opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				c.serverURL = test.serverURL
+				err = c.validateEndpointURL(EndpointMytoken, test.endpointURL)
+				if test.valid && err != nil {
+					t.Errorf("expected %q to be accepted, got %s", test.endpointURL, err)
+				}
+				if !test.valid && !errors.Is(err, ErrInvalidEndpoint) {
+					t.Errorf("expected %q to be rejected with ErrInvalidEndpoint, got %v", test.endpointURL, err)
+				}
+			},
+		)
+	}
+}
@@ -44,16 +44,18 @@ func pollOnce(pollingCode string, endpoint Endpoint, resp interface{}) (bool, er
 // The callback function takes the polling interval and the number of iteration as parameters; it is called for each
 // polling attempt where the final mytoken could not yet be obtained (but no error occurred); it is usually used to
 // print progress output.
-func poll(info api.PollingInfo, callback func(int64, int), endpoint Endpoint, resp interface{}) (bool, error) {
-	expires := time.Now().Add(time.Duration(info.PollingCodeExpiresIn) * time.Second)
+func poll(
+	clock Clock, info api.PollingInfo, callback func(int64, int), endpoint Endpoint, resp interface{},
+) (bool, error) {
+	expires := clock.Now().Add(time.Duration(info.PollingCodeExpiresIn) * time.Second)
 	interval := info.PollingInterval
 	if interval == 0 {
 		interval = 5
 	}
-	tick := time.NewTicker(time.Duration(interval) * time.Second)
+	tick := clock.NewTicker(time.Duration(interval) * time.Second)
 	defer tick.Stop()
 	i := 0
-	for t := range tick.C {
+	for t := range tick.C() {
 		if t.After(expires) {
 			break
 		}
@@ -0,0 +1,129 @@
+package mytokenlib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/oidc-mytoken/api/v0"
+)
+
+// pollingEndpoint is an Endpoint that answers polling requests with authorization_pending until ready polls
+type pollingEndpoint struct {
+	clock *FakeClock
+	ready int
+	polls []time.Time
+}
+
+func (e *pollingEndpoint) DoHTTPRequest(_ string, _, resp interface{}) error {
+	e.polls = append(e.polls, e.clock.Now())
+	if len(e.polls) < e.ready {
+		return MytokenError{err: api.ErrorStrAuthorizationPending}
+	}
+	*resp.(*string) = "mytoken"
+	return nil
+}
+
+type pollResult struct {
+	set bool
+	err error
+}
+
+// startPoll runs poll in the background; each pending poll is reported on the returned pending channel
+func startPoll(clock *FakeClock, info api.PollingInfo, endpoint Endpoint, resp *string) (
+	pending <-chan int, result <-chan pollResult,
+) {
+	pendingC := make(chan int)
+	resultC := make(chan pollResult, 1)
+	go func() {
+		set, err := poll(
+			clock, info, func(_ int64, i int) {
+				pendingC <- i
+			}, endpoint, resp,
+		)
+		resultC <- pollResult{set: set, err: err}
+	}()
+	return pendingC, resultC
+}
+
+func TestPollInterval(t *testing.T) {
+	start := time.Now()
+	clock := NewFakeClock(start)
+	endpoint := &pollingEndpoint{
+		clock: clock,
+		ready: 3,
+	}
+	var resp string
+	pending, result := startPoll(
+		clock, api.PollingInfo{
+			PollingCode:          "code",
+			PollingCodeExpiresIn: 300,
+			PollingInterval:      5,
+		}, endpoint, &resp,
+	)
+	clock.BlockUntilWaiters(1)
+	for second := 1; second <= 15; second++ {
+		clock.Advance(time.Second)
+		// the third poll succeeds and is reported as result
+		if second%5 == 0 && second < 15 {
+			select {
+			case <-pending:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("no poll after %d seconds", second)
+			}
+		}
+	}
+	select {
+	case r := <-result:
+		if r.err != nil || !r.set || resp != "mytoken" {
+			t.Fatalf("expected the polling to succeed, got %t, %v, %q", r.set, r.err, resp)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the polling did not finish")
+	}
+	expected := []time.Time{start.Add(5 * time.Second), start.Add(10 * time.Second), start.Add(15 * time.Second)}
+	if len(endpoint.polls) != len(expected) {
+		t.Fatalf("expected %d polls, got %d", len(expected), len(endpoint.polls))
+	}
+	for i, p := range endpoint.polls {
+		if !p.Equal(expected[i]) {
+			t.Errorf("expected poll %d at %s, got %s", i, expected[i].Sub(start), p.Sub(start))
+		}
+	}
+}
+
+func TestPollExpiry(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	endpoint := &pollingEndpoint{
+		clock: clock,
+		ready: 100,
+	}
+	var resp string
+	pending, result := startPoll(
+		clock, api.PollingInfo{
+			PollingCode:          "code",
+			PollingCodeExpiresIn: 12,
+			PollingInterval:      5,
+		}, endpoint, &resp,
+	)
+	clock.BlockUntilWaiters(1)
+	for i := 0; i < 2; i++ {
+		clock.Advance(5 * time.Second)
+		select {
+		case <-pending:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no poll %d", i)
+		}
+	}
+	clock.Advance(5 * time.Second)
+	select {
+	case r := <-result:
+		if r.err == nil || r.set {
+			t.Fatalf("expected the polling code to expire, got %t, %v", r.set, r.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the polling did not stop after the polling code expired")
+	}
+	if len(endpoint.polls) != 2 {
+		t.Errorf("expected no poll after the polling code expired, got %d polls", len(endpoint.polls))
+	}
+}
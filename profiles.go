@@ -6,11 +6,15 @@ import (
 
 // ProfilesAndTemplatesEndpoint is type representing a mytoken server's Profiles and Templates Endpoint
 type ProfilesAndTemplatesEndpoint struct {
-	endpoint string
+	endpoint *lazyURL
+	client   *client
 }
 
-func newProfilesAndTemplatesEndpoint(endpoint string) *ProfilesAndTemplatesEndpoint {
-	return &ProfilesAndTemplatesEndpoint{endpoint: endpoint}
+func newProfilesAndTemplatesEndpoint(endpoint *lazyURL, c *client) *ProfilesAndTemplatesEndpoint {
+	return &ProfilesAndTemplatesEndpoint{
+		endpoint: endpoint,
+		client:   c,
+	}
 }
 
 // APIGetGroups retrieves all available profile groups
@@ -50,9 +54,12 @@ func (p ProfilesAndTemplatesEndpoint) APIGetProfiles(group string) ([]api.Profil
 
 // DoHTTPRequest performs an http request to the profiles and templates endpoint
 func (p ProfilesAndTemplatesEndpoint) DoHTTPRequest(method string, req, resp interface{}, pathSuffix ...string) error {
-	url := p.endpoint
+	url, err := p.endpoint.get()
+	if err != nil {
+		return err
+	}
 	if len(pathSuffix) > 0 {
 		url += pathSuffix[0]
 	}
-	return doHTTPRequest(method, url, req, resp)
+	return p.client.doHTTPRequest(method, url, req, resp)
 }
@@ -0,0 +1,238 @@
+package mytokenlib
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/oidc-mytoken/api/v0"
+)
+
+// Errors returned when resolving providers and validating scopes; use errors.Is to check for them
+var (
+	// ErrUnknownProvider is returned if a provider is not supported by the mytoken server
+	ErrUnknownProvider = MytokenError{err: "unknown provider"}
+	// ErrAmbiguousProvider is returned if a provider alias matches multiple providers
+	ErrAmbiguousProvider = MytokenError{err: "ambiguous provider"}
+	// ErrUnsupportedScope is returned if a scope is not supported by a provider
+	ErrUnsupportedScope = MytokenError{err: "unsupported scope"}
+)
+
+// WithIssuerAliases enables or disables the resolution of provider aliases in the issuer parameters of
+// AccessTokenEndpoint.APIGet, MytokenEndpoint.APIFromMytoken, and MytokenEndpoint.APIInitAuthorizationFlow, i.e. an
+// alias like "egi" is replaced with the issuer url of the matching provider before the request is sent (see
+// MytokenServer.ResolveIssuer). It is disabled by default; then the issuer must be the issuer url of a provider
+// supported by the server and is sent as passed, and aliases can be resolved explicitly with
+// MytokenServer.ResolveIssuer.
+func WithIssuerAliases(enabled bool) Option {
+	return func(c *client) error {
+		c.resolveIssuerAliases = enabled
+		return nil
+	}
+}
+
+// WithDefaultIssuer sets the oidc issuer that is used by AccessTokenEndpoint.APIGet (and therefore by
+// AccessTokenSources) if no issuer is passed
+func WithDefaultIssuer(issuer string) Option {
+	return func(c *client) error {
+		c.defaultIssuer = issuer
+		return nil
+	}
+}
+
+// Providers returns the OpenID providers supported by the server, including their names, issuers and supported scopes
+func (s *MytokenServer) Providers() []api.SupportedProviderConfig {
+	return s.ServerMetadata.ProvidersSupported
+}
+
+// Provider returns the supported provider that is identified by the passed alias, see ResolveIssuer
+func (s *MytokenServer) Provider(alias string) (api.SupportedProviderConfig, error) {
+	return findProvider(s.ServerMetadata.ProvidersSupported, alias)
+}
+
+// ResolveIssuer resolves the passed alias to the issuer url of a supported provider. The alias can be the issuer url
+// itself, the provider's name, or a unique prefix of the name or of the issuer url without its scheme, e.g. "egi" or
+// "google"; the comparison is case-insensitive.
+func (s *MytokenServer) ResolveIssuer(alias string) (string, error) {
+	p, err := s.Provider(alias)
+	return p.Issuer, err
+}
+
+// ValidateScopes checks that the passed scopes are supported by the provider identified by the passed alias (see
+// ResolveIssuer). For scopes with a parameter, e.g. "storage.read:/home", only the base scope is checked, i.e. they
+// are supported if the provider supports the base scope with any or without a parameter, e.g. "storage.read:/". If
+// the provider does not advertise its scopes, all scopes are accepted.
+func (s *MytokenServer) ValidateScopes(alias string, scopes []string) error {
+	p, err := s.Provider(alias)
+	if err != nil {
+		return err
+	}
+	return validateScopes(p.ScopesSupported, scopes, p.Issuer)
+}
+
+func findProvider(providers []api.SupportedProviderConfig, alias string) (api.SupportedProviderConfig, error) {
+	normalized := normalizeIssuer(alias)
+	if normalized == "" {
+		return api.SupportedProviderConfig{}, MytokenError{
+			err:          ErrUnknownProvider.err,
+			errorDetails: "no provider given",
+		}
+	}
+	if p, ok := findProviderByIssuer(providers, alias); ok {
+		return p, nil
+	}
+	for _, p := range providers {
+		if strings.ToLower(p.Name) == normalized {
+			return p, nil
+		}
+	}
+	var matches []api.SupportedProviderConfig
+	for _, p := range providers {
+		_, issuer, _ := strings.Cut(strings.ToLower(p.Issuer), "://")
+		if strings.HasPrefix(strings.ToLower(p.Name), normalized) || strings.HasPrefix(issuer, normalized) {
+			matches = append(matches, p)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return api.SupportedProviderConfig{}, MytokenError{
+			err:          ErrUnknownProvider.err,
+			errorDetails: "'" + alias + "' does not match any provider supported by the server",
+		}
+	case 1:
+		return matches[0], nil
+	}
+	names := make([]string, len(matches))
+	for i, p := range matches {
+		names[i] = p.Issuer
+	}
+	return api.SupportedProviderConfig{}, MytokenError{
+		err:          ErrAmbiguousProvider.err,
+		errorDetails: "'" + alias + "' matches " + strings.Join(names, ", "),
+	}
+}
+
+// findProviderByIssuer returns the provider with the passed issuer url; a trailing slash and the case are ignored
+func findProviderByIssuer(providers []api.SupportedProviderConfig, issuer string) (api.SupportedProviderConfig, bool) {
+	normalized := normalizeIssuer(issuer)
+	for _, p := range providers {
+		if normalizeIssuer(p.Issuer) == normalized {
+			return p, true
+		}
+	}
+	return api.SupportedProviderConfig{}, false
+}
+
+func normalizeIssuer(issuer string) string {
+	return strings.TrimSuffix(strings.ToLower(issuer), "/")
+}
+
+// validateScopes checks that the passed scopes are contained in the supported scopes; provider is only used for the
+// error message
+func validateScopes(supportedScopes, scopes []string, provider string) error {
+	if len(supportedScopes) == 0 {
+		return nil
+	}
+	for _, scope := range scopes {
+		if scope == "" || scopeSupported(supportedScopes, scope) {
+			continue
+		}
+		details := "'" + scope + "'"
+		if provider != "" {
+			details += " is not supported by " + provider
+		} else {
+			details += " is not supported by any provider of the server"
+		}
+		return MytokenError{
+			err:          ErrUnsupportedScope.err,
+			errorDetails: details,
+		}
+	}
+	return nil
+}
+
+// scopeSupported checks if the passed scope is contained in the supported scopes; for a scope with a parameter only
+// its base scope is checked, since the supported scopes usually only list one parameter, e.g. "storage.read:/"
+func scopeSupported(supportedScopes []string, scope string) bool {
+	if slices.Contains(supportedScopes, scope) {
+		return true
+	}
+	base, _, parametrized := strings.Cut(scope, ":")
+	if !parametrized {
+		return false
+	}
+	return slices.ContainsFunc(
+		supportedScopes, func(supported string) bool {
+			supportedBase, _, _ := strings.Cut(supported, ":")
+			return supportedBase == base
+		},
+	)
+}
+
+// provider returns the supported provider for the passed issuer; provider aliases are only resolved if enabled with
+// WithIssuerAliases
+func (c *client) provider(issuer string) (api.SupportedProviderConfig, error) {
+	if c.resolveIssuerAliases {
+		return findProvider(c.metadata.ProvidersSupported, issuer)
+	}
+	if p, ok := findProviderByIssuer(c.metadata.ProvidersSupported, issuer); ok {
+		return p, nil
+	}
+	return api.SupportedProviderConfig{}, MytokenError{
+		err:          ErrUnknownProvider.err,
+		errorDetails: "'" + issuer + "' is not the issuer of a provider supported by the server",
+	}
+}
+
+// resolveIssuer checks that the passed issuer belongs to a provider supported by the server, if the server's
+// providers are known, and returns the provider's issuer url; provider aliases are only resolved if enabled with
+// WithIssuerAliases. An empty issuer is returned unchanged, since the server then uses the issuer of the mytoken.
+func (c *client) resolveIssuer(issuer string) (string, error) {
+	if issuer == "" || c == nil || c.metadata == nil || len(c.metadata.ProvidersSupported) == 0 {
+		return issuer, nil
+	}
+	if !c.resolveIssuerAliases {
+		if _, err := c.provider(issuer); err != nil {
+			return "", err
+		}
+		return issuer, nil
+	}
+	p, err := c.provider(issuer)
+	return p.Issuer, err
+}
+
+// validateScopes checks the passed scopes against the scopes supported by the provider with the passed issuer; if the
+// issuer is empty, the scopes are checked against the scopes of all providers
+func (c *client) validateScopes(issuer string, scopes []string) error {
+	if len(scopes) == 0 || c == nil || c.metadata == nil || len(c.metadata.ProvidersSupported) == 0 {
+		return nil
+	}
+	if issuer != "" {
+		p, err := c.provider(issuer)
+		if err != nil {
+			return err
+		}
+		return validateScopes(p.ScopesSupported, scopes, p.Issuer)
+	}
+	var all []string
+	for _, p := range c.metadata.ProvidersSupported {
+		if len(p.ScopesSupported) == 0 {
+			// one provider accepts all scopes
+			return nil
+		}
+		all = append(all, p.ScopesSupported...)
+	}
+	return validateScopes(all, scopes, "")
+}
+
+// validateRestrictionScopes checks the scopes of the passed api.Restrictions, see validateScopes
+func (c *client) validateRestrictionScopes(issuer string, restrictions api.Restrictions) error {
+	for _, r := range restrictions {
+		if r == nil {
+			continue
+		}
+		if err := c.validateScopes(issuer, strings.Fields(r.Scope)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package mytokenlib
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/oidc-mytoken/api/v0"
+)
+
+func TestScopeSupported(t *testing.T) {
+	supportedScopes := []string{"openid", "profile", "storage.read:/", "compute.create"}
+	tests := map[string]bool{
+		"openid":                 true,
+		"email":                  false,
+		"storage.read:/":         true,
+		"storage.read:/home":     true,
+		"storage.read:/home/foo": true,
+		"storage.write:/home":    false,
+		"compute.create:queue":   true,
+		"profile.extended":       false,
+	}
+	for scope, expected := range tests {
+		if supported := scopeSupported(supportedScopes, scope); supported != expected {
+			t.Errorf("%q: expected supported to be %t, got %t", scope, expected, supported)
+		}
+	}
+}
+
+func TestIssuerAliases(t *testing.T) {
+	var issuers []string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var req api.AccessTokenRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		issuers = append(issuers, req.Issuer)
+		writeJSON(w, http.StatusOK, api.AccessTokenResponse{AccessToken: "at"})
+	}
+
+	server := newTestMytokenServer(t, handler, nil)
+	if _, err := server.AccessToken.APIGet("mytoken", "example", nil, nil, ""); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("expected an error matching ErrUnknownProvider without alias resolution, got: %v", err)
+	}
+	if _, err := server.AccessToken.APIGet("mytoken", "https://op.example.com", nil, nil, ""); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	server = newTestMytokenServer(t, handler, nil, WithIssuerAliases(true))
+	if _, err := server.AccessToken.APIGet("mytoken", "example", []string{"storage.read:/home"}, nil, ""); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	expected := []string{"https://op.example.com", "https://op.example.com"}
+	if !slices.Equal(issuers, expected) {
+		t.Errorf("expected the requests to use the issuers %v, got %v", expected, issuers)
+	}
+}
@@ -0,0 +1,249 @@
+package mytokenlib
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRateLimitMaxWait is the maximum time a request waits because of rate limiting if RateLimit.MaxWait is not
+// set
+const DefaultRateLimitMaxWait = 30 * time.Second
+
+// minRateFactor is the factor of RateLimit.RequestsPerSecond the rate is reduced to at most when the server throttles
+// requests
+const minRateFactor = 0.1
+
+// ErrRateLimited is returned if a request is not sent because it would have to wait longer than RateLimit.MaxWait
+// because of rate limiting. Use errors.Is to check for it.
+var ErrRateLimited = MytokenError{err: "rate limited"}
+
+// RateLimit configures the rate limiting of the requests to a mytoken server, see WithRateLimit.
+// Independently of the client-side limit, the rate limit headers sent by the server (RateLimit-Limit,
+// RateLimit-Remaining, RateLimit-Reset, their X-RateLimit- variants, and Retry-After) are always honoured: if the
+// server reports that no requests remain or asks to retry later, requests wait until the limit is reset.
+type RateLimit struct {
+	// RequestsPerSecond is the number of requests that are sent per second on average; if 0, requests are only
+	// limited by the server's rate limit headers. If the server throttles requests (http status 429), the rate is
+	// halved, down to a tenth of RequestsPerSecond, and slowly restored with subsequent successful requests.
+	RequestsPerSecond float64
+	// Burst is the number of requests that can be sent at once; values smaller than 1 are treated as 1
+	Burst int
+	// MaxWait is the maximum time a request waits; requests that would have to wait longer fail with an error
+	// matching ErrRateLimited. If 0, DefaultRateLimitMaxWait is used.
+	MaxWait time.Duration
+}
+
+// RateLimitStatus describes the current rate limit status of a mytoken server, see MytokenServer.RateLimitStatus
+type RateLimitStatus struct {
+	// Limit is the request quota reported by the server, or -1 if unknown
+	Limit int
+	// Remaining is the number of remaining requests reported by the server, or -1 if unknown
+	Remaining int
+	// Reset is the time the server's quota is reset, if known
+	Reset time.Time
+	// RetryAfter is the time until which requests wait because the server asked to retry later
+	RetryAfter time.Time
+	// Throttled is the number of requests the server throttled with http status 429
+	Throttled int
+	// RequestsPerSecond is the current client-side rate, which might be reduced because the server throttled
+	// requests; 0 if there is no client-side limit
+	RequestsPerSecond float64
+}
+
+// WithRateLimit enables a client-side rate limit for the requests to the server
+func WithRateLimit(limit RateLimit) Option {
+	return func(c *client) error {
+		if limit.RequestsPerSecond < 0 || limit.MaxWait < 0 {
+			return MytokenError{
+				err:          "invalid rate limit",
+				errorDetails: "values must not be negative",
+			}
+		}
+		c.rateLimit = limit
+		return nil
+	}
+}
+
+// RateLimitStatus returns the current rate limit status of the server as observed from the responses
+func (s *MytokenServer) RateLimitStatus() RateLimitStatus {
+	if s.client == nil || s.client.limiter == nil {
+		return RateLimitStatus{
+			Limit:     -1,
+			Remaining: -1,
+		}
+	}
+	return s.client.limiter.status()
+}
+
+// rateLimiter is a token bucket rate limiter that additionally honours the rate limit headers of the server; it is
+// safe for concurrent use
+type rateLimiter struct {
+	mutex  sync.Mutex
+	clock  Clock
+	config RateLimit
+	rate   float64
+	tokens float64
+	last   time.Time
+
+	limit        int
+	remaining    int
+	reset        time.Time
+	blockedUntil time.Time
+	throttled    int
+}
+
+func newRateLimiter(config RateLimit, clock Clock) *rateLimiter {
+	if config.Burst < 1 {
+		config.Burst = 1
+	}
+	if config.MaxWait == 0 {
+		config.MaxWait = DefaultRateLimitMaxWait
+	}
+	return &rateLimiter{
+		clock:     clock,
+		config:    config,
+		rate:      config.RequestsPerSecond,
+		tokens:    float64(config.Burst),
+		last:      clock.Now(),
+		limit:     -1,
+		remaining: -1,
+	}
+}
+
+func (l *rateLimiter) status() RateLimitStatus {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return RateLimitStatus{
+		Limit:             l.limit,
+		Remaining:         l.remaining,
+		Reset:             l.reset,
+		RetryAfter:        l.blockedUntil,
+		Throttled:         l.throttled,
+		RequestsPerSecond: l.rate,
+	}
+}
+
+// reserve reserves the sending of a request and returns how long to wait before sending it
+func (l *rateLimiter) reserve() (time.Duration, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.clock.Now()
+	var wait time.Duration
+	consumed := false
+	if l.rate > 0 {
+		l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, float64(l.config.Burst))
+		l.last = now
+		l.tokens--
+		consumed = true
+		if l.tokens < 0 {
+			wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+		}
+	}
+	if l.blockedUntil.After(now) {
+		wait = max(wait, l.blockedUntil.Sub(now))
+	}
+	if l.remaining == 0 && l.reset.After(now) {
+		wait = max(wait, l.reset.Sub(now))
+	}
+	if wait > l.config.MaxWait {
+		if consumed {
+			l.tokens++
+		}
+		return 0, MytokenError{
+			err:          ErrRateLimited.err,
+			errorDetails: fmt.Sprintf("the request would have to wait %s", wait.Round(time.Second)),
+		}
+	}
+	if l.remaining > 0 {
+		l.remaining--
+	}
+	return wait, nil
+}
+
+// wait waits until a request may be sent
+func (l *rateLimiter) wait(ctx context.Context, c *client, r request) error {
+	d, err := l.reserve()
+	if err != nil || d <= 0 {
+		return err
+	}
+	c.log(slog.LevelDebug, "waiting because of rate limit", "request", r.description, "wait", d)
+	timer := l.clock.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C():
+		return nil
+	}
+}
+
+// observe updates the rate limit status from the headers of the passed response; absolute times in the headers are
+// converted to local times with the passed clock skew of the server
+func (l *rateLimiter) observe(resp *http.Response, skew time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.clock.Now()
+	if v, ok := rateLimitHeader(resp.Header, "Limit"); ok {
+		if limit, err := strconv.Atoi(v); err == nil {
+			l.limit = limit
+		}
+	}
+	if v, ok := rateLimitHeader(resp.Header, "Remaining"); ok {
+		if remaining, err := strconv.Atoi(v); err == nil {
+			l.remaining = remaining
+		}
+	}
+	if v, ok := rateLimitHeader(resp.Header, "Reset"); ok {
+		if reset, err := strconv.ParseInt(v, 10, 64); err == nil {
+			if reset > 1e9 {
+				// some servers send a unix timestamp instead of the number of seconds
+				l.reset = time.Unix(reset, 0).Add(-skew)
+			} else {
+				l.reset = now.Add(time.Duration(reset) * time.Second)
+			}
+		}
+	}
+	if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), now, skew); ok {
+		l.blockedUntil = retryAfter
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		l.throttled++
+		if l.config.RequestsPerSecond > 0 {
+			l.rate = max(l.rate/2, l.config.RequestsPerSecond*minRateFactor)
+		}
+		return
+	}
+	if l.rate < l.config.RequestsPerSecond {
+		l.rate = min(l.rate+l.config.RequestsPerSecond*minRateFactor, l.config.RequestsPerSecond)
+	}
+}
+
+// rateLimitHeader returns the value of the passed RateLimit- header or its X-RateLimit- variant
+func rateLimitHeader(header http.Header, name string) (string, bool) {
+	for _, prefix := range []string{"RateLimit-", "X-RateLimit-"} {
+		if v := strings.TrimSpace(header.Get(prefix + name)); v != "" {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either a number of seconds or an http date of
+// the server's clock, which is converted to a local time with the passed clock skew
+func parseRetryAfter(value string, now time.Time, skew time.Duration) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		return now.Add(time.Duration(secs) * time.Second), true
+	}
+	t, err := http.ParseTime(value)
+	return t.Add(-skew), err == nil
+}
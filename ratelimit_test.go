@@ -0,0 +1,286 @@
+package mytokenlib
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/oidc-mytoken/api/v0"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		value    string
+		skew     time.Duration
+		expected time.Time
+	}{
+		{name: "empty"},
+		{
+			name:     "seconds",
+			value:    "120",
+			expected: now.Add(2 * time.Minute),
+		},
+		{
+			name:     "seconds with whitespace",
+			value:    " 5 ",
+			expected: now.Add(5 * time.Second),
+		},
+		{
+			name:     "http date",
+			value:    "Thu, 01 Jan 2026 12:01:00 GMT",
+			expected: now.Add(time.Minute),
+		},
+		{
+			name:     "http date of a server whose clock is ahead",
+			value:    "Thu, 01 Jan 2026 12:01:00 GMT",
+			skew:     10 * time.Second,
+			expected: now.Add(50 * time.Second),
+		},
+		{
+			name:  "seconds are not skewed",
+			value: "60",
+			skew:  10 * time.Second,
+			// the number of seconds is relative to the time the response was received
+			expected: now.Add(time.Minute),
+		},
+		{
+			name:  "invalid",
+			value: "soon",
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				retryAfter, ok := parseRetryAfter(test.value, now, test.skew)
+				if ok != !test.expected.IsZero() {
+					t.Fatalf("expected ok to be %t, got %t", !test.expected.IsZero(), ok)
+				}
+				if ok && !retryAfter.Equal(test.expected) {
+					t.Errorf("expected %s, got %s", test.expected, retryAfter)
+				}
+			},
+		)
+	}
+}
+
+func TestRateLimiterObserve(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		status   int
+		header   map[string]string
+		skew     time.Duration
+		expected RateLimitStatus
+	}{
+		{
+			name:   "no headers",
+			status: http.StatusOK,
+			expected: RateLimitStatus{
+				Limit:             -1,
+				Remaining:         -1,
+				RequestsPerSecond: 8,
+			},
+		},
+		{
+			name:   "RateLimit headers",
+			status: http.StatusOK,
+			header: map[string]string{
+				"RateLimit-Limit":     "100",
+				"RateLimit-Remaining": "5",
+				"RateLimit-Reset":     "30",
+			},
+			expected: RateLimitStatus{
+				Limit:             100,
+				Remaining:         5,
+				Reset:             now.Add(30 * time.Second),
+				RequestsPerSecond: 8,
+			},
+		},
+		{
+			name:   "X-RateLimit headers",
+			status: http.StatusOK,
+			header: map[string]string{
+				"X-RateLimit-Limit":     "100",
+				"X-RateLimit-Remaining": "0",
+				"X-RateLimit-Reset":     "10",
+			},
+			expected: RateLimitStatus{
+				Limit:             100,
+				Remaining:         0,
+				Reset:             now.Add(10 * time.Second),
+				RequestsPerSecond: 8,
+			},
+		},
+		{
+			name:   "RateLimit headers take precedence",
+			status: http.StatusOK,
+			header: map[string]string{
+				"RateLimit-Remaining":   "5",
+				"X-RateLimit-Remaining": "0",
+			},
+			expected: RateLimitStatus{
+				Limit:             -1,
+				Remaining:         5,
+				RequestsPerSecond: 8,
+			},
+		},
+		{
+			name:   "reset as unix timestamp",
+			status: http.StatusOK,
+			header: map[string]string{
+				"RateLimit-Reset": "1767268860",
+			},
+			skew: 10 * time.Second,
+			expected: RateLimitStatus{
+				Limit:             -1,
+				Remaining:         -1,
+				Reset:             now.Add(50 * time.Second),
+				RequestsPerSecond: 8,
+			},
+		},
+		{
+			name:   "invalid values",
+			status: http.StatusOK,
+			header: map[string]string{
+				"RateLimit-Limit":     "many",
+				"RateLimit-Remaining": "-",
+				"RateLimit-Reset":     "later",
+				"Retry-After":         "soon",
+			},
+			expected: RateLimitStatus{
+				Limit:             -1,
+				Remaining:         -1,
+				RequestsPerSecond: 8,
+			},
+		},
+		{
+			name:   "throttled",
+			status: http.StatusTooManyRequests,
+			header: map[string]string{
+				"Retry-After": "120",
+			},
+			expected: RateLimitStatus{
+				Limit:             -1,
+				Remaining:         -1,
+				RetryAfter:        now.Add(2 * time.Minute),
+				Throttled:         1,
+				RequestsPerSecond: 4,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				limiter := newRateLimiter(RateLimit{RequestsPerSecond: 8}, NewFakeClock(now))
+				resp := &http.Response{
+					StatusCode: test.status,
+					Header:     http.Header{},
+				}
+				for k, v := range test.header {
+					resp.Header.Set(k, v)
+				}
+				limiter.observe(resp, test.skew)
+				status := limiter.status()
+				if status.Limit != test.expected.Limit || status.Remaining != test.expected.Remaining ||
+					!status.Reset.Equal(test.expected.Reset) || !status.RetryAfter.Equal(test.expected.RetryAfter) ||
+					status.Throttled != test.expected.Throttled ||
+					status.RequestsPerSecond != test.expected.RequestsPerSecond {
+					t.Errorf("expected %+v, got %+v", test.expected, status)
+				}
+			},
+		)
+	}
+}
+
+func TestRateLimiterHalvesRateWhenThrottled(t *testing.T) {
+	limiter := newRateLimiter(RateLimit{RequestsPerSecond: 8}, NewFakeClock(time.Now()))
+	throttled := &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     http.Header{},
+	}
+	for _, expected := range []float64{4, 2, 1, 0.8, 0.8} {
+		limiter.observe(throttled, 0)
+		if rate := limiter.status().RequestsPerSecond; rate != expected {
+			t.Errorf("expected the rate to be reduced to %g, got %g", expected, rate)
+		}
+	}
+	ok := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+	}
+	limiter.observe(ok, 0)
+	if rate := limiter.status().RequestsPerSecond; rate != 1.6 {
+		t.Errorf("expected the rate to be restored slowly, got %g", rate)
+	}
+	for i := 0; i < 10; i++ {
+		limiter.observe(ok, 0)
+	}
+	if status := limiter.status(); status.RequestsPerSecond != 8 || status.Throttled != 5 {
+		t.Errorf("expected the configured rate to be restored, got %+v", status)
+	}
+}
+
+func TestRateLimitHeadersFromServer(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				switch hits.Add(1) {
+				case 1:
+					w.Header().Set("Retry-After", "5")
+					writeJSON(w, http.StatusTooManyRequests, api.Error{Error: "too many requests"})
+				case 2:
+					w.Header().Set("RateLimit-Remaining", "0")
+					w.Header().Set("RateLimit-Reset", "60")
+					writeJSON(w, http.StatusOK, map[string]string{})
+				default:
+					writeJSON(w, http.StatusOK, map[string]string{})
+				}
+			},
+		),
+	)
+	t.Cleanup(srv.Close)
+	clock := NewFakeClock(time.Now())
+	c, err := newClient([]Option{WithClock(clock), WithRateLimit(RateLimit{MaxWait: 30 * time.Second})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func() error {
+		_, err := c.doRequest(http.MethodGet, srv.URL, nil, &map[string]string{}, "")
+		return err
+	}
+	if err = get(); err == nil {
+		t.Fatal("expected the throttled request to fail")
+	}
+
+	// the request waits until the Retry-After time
+	done := make(chan error)
+	go func() {
+		done <- get()
+	}()
+	clock.BlockUntilWaiters(1)
+	if n := hits.Load(); n != 1 {
+		t.Fatalf("expected the request to wait for the Retry-After time, but it was sent")
+	}
+	clock.Advance(5 * time.Second)
+	if err = <-done; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// no requests remain until the reset, which is longer than the maximum wait time
+	if err = get(); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited, got %v", err)
+	}
+	if n := hits.Load(); n != 2 {
+		t.Errorf("expected the rate limited request not to be sent, got %d requests", n)
+	}
+	clock.Advance(time.Minute)
+	if err = get(); err != nil {
+		t.Errorf("expected the request to be sent after the reset, got %s", err)
+	}
+}
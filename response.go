@@ -0,0 +1,113 @@
+package mytokenlib
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// RequestIDHeader is the http header in which the id of each request is sent to the server
+const RequestIDHeader = "X-Request-Id"
+
+// serverRequestIDHeaders are the response headers in which servers and proxies commonly report their request id
+var serverRequestIDHeaders = []string{
+	RequestIDHeader,
+	"X-Correlation-Id",
+	"Request-Id",
+}
+
+// Response describes the http response to a request to a mytoken server, see MytokenServer.WithResponse
+type Response struct {
+	// RequestID is the id the library generated for the request and sent in the RequestIDHeader; retries and
+	// fail overs of a request use the same id
+	RequestID string
+	// ServerRequestID is the request id reported by the server or a proxy in its response, if any
+	ServerRequestID string
+	// StatusCode is the http status code of the response, or 0 if no response was received
+	StatusCode int
+	// Status is the http status of the response, e.g. "200 OK"
+	Status string
+	// Header holds the response headers, e.g. caching and rate limit headers
+	Header http.Header
+	// URL is the url the request was finally sent to, which might be a mirror's url, see WithMirrors
+	URL string
+}
+
+// WithResponse returns a copy of the MytokenServer that records the http response of each request it makes into the
+// passed Response, so that the status, headers, and request ids are available alongside the decoded result, e.g.:
+//
+//	var resp mytokenlib.Response
+//	at, err := server.WithResponse(&resp).AccessToken.APIGet(mytoken, issuer, nil, nil, "")
+//
+// If an API method makes multiple requests, the Response describes the last one. The copy shares its configuration,
+// e.g. the http client, rate limiter, and circuit breaker, with the original MytokenServer; since it writes into the
+// same Response, it should not be used for concurrent requests.
+func (s *MytokenServer) WithResponse(resp *Response) *MytokenServer {
+	c := &client{}
+	if s.client != nil {
+		*c = *s.client
+	}
+	c.response = resp
+	server := buildMytokenServer(s.url, s.ServerMetadata, c)
+	if m, ok := s.UserSettings.knownMetaData(); ok {
+		server.UserSettings = newUserSettingsEndpointFromMetadata(
+			c.endpointURL(EndpointUserSettings, s.ServerMetadata.UserSettingsEndpoint), m, c,
+		)
+	}
+	return server
+}
+
+// RequestID returns the id of the request that caused this error, if the error was returned for a request to a
+// mytoken server; it matches the Response.RequestID and is sent to the server in the RequestIDHeader
+func (err MytokenError) RequestID() string {
+	return err.requestID
+}
+
+// StatusCode returns the http status code of the response that caused this error, or 0 if the error was not caused
+// by an http response
+func (err MytokenError) StatusCode() int {
+	return err.statusCode
+}
+
+// newRequestID generates a random request id
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// recordResponse records the passed response to the request with the passed id into the client's Response, if any
+func (c *client) recordResponse(requestID string, resp *http.Response) {
+	if c == nil || c.response == nil {
+		return
+	}
+	*c.response = Response{RequestID: requestID}
+	if resp == nil {
+		return
+	}
+	c.response.StatusCode = resp.StatusCode
+	c.response.Status = resp.Status
+	c.response.Header = resp.Header
+	if resp.Request != nil {
+		c.response.URL = resp.Request.URL.String()
+	}
+	for _, h := range serverRequestIDHeaders {
+		if id := resp.Header.Get(h); id != "" {
+			c.response.ServerRequestID = id
+			break
+		}
+	}
+}
+
+// withRequestInfo attaches the passed request id and the status of the passed response to a MytokenError
+func withRequestInfo(err error, requestID string, resp *http.Response) error {
+	mytokenErr, ok := err.(MytokenError)
+	if !ok {
+		return err
+	}
+	mytokenErr.requestID = requestID
+	if resp != nil {
+		mytokenErr.statusCode = resp.StatusCode
+	}
+	return mytokenErr
+}
@@ -0,0 +1,136 @@
+package mytokenlib
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/oidc-mytoken/api/v0"
+)
+
+// requestIDRecorder records the request ids sent to a test server
+type requestIDRecorder struct {
+	mutex sync.Mutex
+	ids   []string
+}
+
+func (r *requestIDRecorder) record(req *http.Request) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.ids = append(r.ids, req.Header.Get(RequestIDHeader))
+}
+
+func (r *requestIDRecorder) get() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string{}, r.ids...)
+}
+
+func TestWithResponse(t *testing.T) {
+	var ids requestIDRecorder
+	server := newTestMytokenServer(
+		t, func(w http.ResponseWriter, r *http.Request) {
+			ids.record(r)
+			w.Header().Set("X-Correlation-Id", "server-id")
+			w.Header().Set("Cache-Control", "no-store")
+			if strings.Contains(r.URL.RawQuery, "fail") {
+				writeJSON(w, http.StatusBadRequest, api.Error{Error: "invalid_request"})
+				return
+			}
+			writeJSON(w, http.StatusOK, api.AccessTokenResponse{AccessToken: "at"})
+		}, nil,
+	)
+
+	var resp Response
+	if _, err := server.WithResponse(&resp).AccessToken.APIGet("mytoken", "", nil, nil, ""); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	sent := ids.get()
+	if len(sent) != 1 || sent[0] == "" || resp.RequestID != sent[0] {
+		t.Errorf("expected the request id %q that was sent, got %q", sent, resp.RequestID)
+	}
+	if resp.ServerRequestID != "server-id" {
+		t.Errorf("expected the server's request id, got %q", resp.ServerRequestID)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Status != "200 OK" || resp.Header.Get("Cache-Control") != "no-store" {
+		t.Errorf("expected the status and headers of the response, got %+v", resp)
+	}
+	if resp.URL != server.AccessToken.endpoint {
+		t.Errorf("expected the url %q, got %q", server.AccessToken.endpoint, resp.URL)
+	}
+
+	// the original MytokenServer does not record responses
+	recorded := resp
+	if _, err := server.AccessToken.APIGet("mytoken", "", nil, nil, ""); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if resp.RequestID != recorded.RequestID {
+		t.Error("expected the original MytokenServer not to record the response")
+	}
+
+	// request ids and status codes are attached to errors
+	failing := server.WithResponse(&resp)
+	failing.AccessToken.endpoint += "?fail=1"
+	_, err := failing.AccessToken.APIGet("mytoken", "", nil, nil, "")
+	var mytokenErr MytokenError
+	if !errors.As(err, &mytokenErr) {
+		t.Fatalf("expected a MytokenError, got %v", err)
+	}
+	sent = ids.get()
+	if mytokenErr.RequestID() != sent[len(sent)-1] || mytokenErr.RequestID() != resp.RequestID {
+		t.Errorf("expected the error to carry the request id %q, got %q", resp.RequestID, mytokenErr.RequestID())
+	}
+	if mytokenErr.StatusCode() != http.StatusBadRequest || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected the status code 400, got %d and %d", mytokenErr.StatusCode(), resp.StatusCode)
+	}
+}
+
+func TestRequestIDOfFailedRequest(t *testing.T) {
+	var ids requestIDRecorder
+	srv := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				ids.record(r)
+				w.WriteHeader(http.StatusServiceUnavailable)
+			},
+		),
+	)
+	t.Cleanup(srv.Close)
+	var resp Response
+	c, err := newClient([]Option{WithRetryPolicy(RetryPolicy{MaxAttempts: 3})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.response = &resp
+	_, err = c.doRequest(http.MethodGet, srv.URL, nil, &map[string]string{}, "")
+	var mytokenErr MytokenError
+	if !errors.As(err, &mytokenErr) {
+		t.Fatalf("expected a MytokenError, got %v", err)
+	}
+	sent := ids.get()
+	if len(sent) != 3 || sent[0] != sent[1] || sent[1] != sent[2] {
+		t.Errorf("expected the retries to use the same request id, got %q", sent)
+	}
+	if mytokenErr.RequestID() != sent[0] || resp.RequestID != sent[0] {
+		t.Errorf("expected the request id %q, got %q and %q", sent[0], mytokenErr.RequestID(), resp.RequestID)
+	}
+	if mytokenErr.StatusCode() != http.StatusServiceUnavailable || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected the status code 503, got %d and %d", mytokenErr.StatusCode(), resp.StatusCode)
+	}
+
+	// without a response there is no status code
+	srv.Close()
+	_, err = c.doRequest(http.MethodGet, srv.URL, nil, &map[string]string{}, "")
+	if !errors.As(err, &mytokenErr) {
+		t.Fatalf("expected a MytokenError, got %v", err)
+	}
+	if mytokenErr.RequestID() == "" || mytokenErr.RequestID() != resp.RequestID || mytokenErr.RequestID() == sent[0] {
+		t.Errorf("expected a new request id, got %q", mytokenErr.RequestID())
+	}
+	if mytokenErr.StatusCode() != 0 || resp.StatusCode != 0 {
+		t.Errorf("expected no status code, got %d and %d", mytokenErr.StatusCode(), resp.StatusCode)
+	}
+}
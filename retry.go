@@ -0,0 +1,81 @@
+package mytokenlib
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy describes if and how failed requests are retried.
+// Requests are retried if the connection to the server could not be established, because then the request did not
+// reach the server. Requests that do not use a mytoken are additionally retried on other network errors and on the
+// http status codes 429, 502, 503, and 504. Requests that use a mytoken are never retried after they might have
+// reached the server, since the server might have rotated the mytoken.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts for a request, including the first one; values smaller than 2
+	// disable retries
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry; it is doubled for each further retry
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum delay between two attempts; if 0, the delay is not limited
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy is a RetryPolicy with sensible defaults
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+}
+
+// backoff returns the delay after the passed attempt
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if p.MaxBackoff > 0 && d > p.MaxBackoff {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// shouldRetry decides if a request should be retried after the passed result
+func (RetryPolicy) shouldRetry(r request, resp *http.Response, err error) bool {
+	return canResend(r, resp, err)
+}
+
+// canResend decides if a request can be sent again, to the same or to another server, after the passed result;
+// requests that might have rotated a mytoken are only sent again if they did not reach the server
+func canResend(r request, resp *http.Response, err error) bool {
+	if err != nil {
+		if errors.As(err, &MytokenError{}) {
+			// errors from the library itself, e.g. a public key pin mismatch, do not change when retrying
+			return false
+		}
+		return isConnectError(err) || r.replayable
+	}
+	if !r.replayable {
+		return false
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// isConnectError checks if the passed error occurred while establishing the connection, i.e. before the request
+// was sent
+func isConnectError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
@@ -8,16 +8,21 @@ import (
 // performed there.
 type RevocationEndpoint struct {
 	endpoint string
+	client   *client
 }
 
 // DoHTTPRequest performs an http request to the revocation endpoint
 func (r RevocationEndpoint) DoHTTPRequest(method string, req, resp interface{}) error {
-	return doHTTPRequest(method, r.endpoint, req, resp)
+	if r.endpoint == "" {
+		return errEndpointUnsupported("revocation")
+	}
+	return r.client.doHTTPRequest(method, r.endpoint, req, resp)
 }
 
-func newRevocationEndpoint(endpoint string) *RevocationEndpoint {
+func newRevocationEndpoint(endpoint string, c *client) *RevocationEndpoint {
 	return &RevocationEndpoint{
 		endpoint: endpoint,
+		client:   c,
 	}
 }
 
@@ -1,10 +1,14 @@
 package mytokenlib
 
 import (
+	"encoding/json"
+
 	"github.com/oidc-mytoken/api/v0"
 )
 
-// MytokenServer is a type describing a mytoken server instance
+// MytokenServer is a type describing a mytoken server instance.
+// A MytokenServer can be serialised with json.Marshal and restored without network access with
+// RestoreMytokenServer.
 type MytokenServer struct {
 	ServerMetadata       api.MytokenConfiguration
 	AccessToken          *AccessTokenEndpoint
@@ -16,6 +20,9 @@ type MytokenServer struct {
 	Notifications        *NotificationsEndpoint
 	Calendars            *CalendarsEndpoint
 	ProfilesAndTemplates *ProfilesAndTemplatesEndpoint
+
+	url    string
+	client *client
 }
 
 // Endpoint is an interface for mytoken endpoints
@@ -23,36 +30,134 @@ type Endpoint interface {
 	DoHTTPRequest(method string, req interface{}, resp interface{}) error
 }
 
-// NewMytokenServer creates a new MytokenServer
+// NewMytokenServer creates a new MytokenServer.
+// Requests that the server does not support according to its metadata fail with an error matching
+// ErrUnsupportedByServer without contacting the server, see also MytokenServer.Supports. The optional endpoints
+// Notifications, Calendars, and ProfilesAndTemplates are nil if the server does not advertise them and they are not
+// overridden with WithEndpointOverride; for the UserSettings sub-endpoints see UserSettingsEndpoint.
+// The advertised endpoints must have the same origin as the server, see WithEndpointValidation.
+// Only the server metadata is discovered, sub-endpoints that need a further discovery (e.g. the UserSettings
+// sub-endpoints) are discovered when they are first used; the urls of the optional endpoints (e.g. Notifications) are
+// also only resolved when they are first used.
+// If a DiscoveryCache is set (see SetDiscoveryCache), the server metadata is taken from the cache while it is fresh;
+// if the discovery fails, stale cached metadata is used and refreshed in the background. The refreshed metadata is
+// only stored in the cache and used by MytokenServers created later; the returned MytokenServer keeps the stale
+// metadata.
 func NewMytokenServer(url string) (*MytokenServer, error) {
+	c, err := newClient(nil)
+	if err != nil {
+		return nil, err
+	}
+	return newMytokenServer(url, c)
+}
+
+// newMytokenServer creates a new MytokenServer that uses the passed client for all requests
+func newMytokenServer(url string, c *client) (*MytokenServer, error) {
+	c.setServerURL(url)
 	configEndpoint := url
 	if url[len(url)-1] != '/' {
 		configEndpoint += "/"
 	}
 	configEndpoint += ".well-known/mytoken-configuration"
 	var respData api.MytokenConfiguration
-	if err := doHTTPRequest("GET", configEndpoint, nil, &respData); err != nil {
+	if err := c.discover(configEndpoint, &respData); err != nil {
 		return nil, err
 	}
+	return newMytokenServerFromMetadata(url, respData, c)
+}
+
+// newMytokenServerFromMetadata creates a new MytokenServer from the passed api.MytokenConfiguration; no requests are
+// made, sub-endpoints that need a discovery are discovered when they are first used
+func newMytokenServerFromMetadata(url string, metadata api.MytokenConfiguration, c *client) (*MytokenServer, error) {
+	c.metadata = &metadata
+	c.setServerURL(url)
+	if err := c.checkCompatibility(metadata); err != nil {
+		return nil, err
+	}
+	if err := c.validateEndpoints(metadata); err != nil {
+		return nil, err
+	}
+	return buildMytokenServer(url, metadata, c), nil
+}
+
+// buildMytokenServer creates the MytokenServer and its endpoints for already validated metadata
+func buildMytokenServer(url string, metadata api.MytokenConfiguration, c *client) *MytokenServer {
+	notifications := newAdvertisedURL(EndpointNotifications, c, metadata.NotificationsEndpoint)
+	profiles := newAdvertisedURL(EndpointProfiles, c, metadata.ProfilesEndpoint)
 	server := &MytokenServer{
-		ServerMetadata: respData,
-		AccessToken:    newAccessTokenEndpoint(respData.AccessTokenEndpoint),
-		Mytoken:        newMytokenEndpoint(respData.MytokenEndpoint),
-		Revocation:     newRevocationEndpoint(respData.RevocationEndpoint),
-		Tokeninfo:      newTokeninfoEndpoint(respData.TokeninfoEndpoint),
-		Transfer:       newTransferEndpoint(respData.TokenTransferEndpoint),
-	}
-	var err error
-	server.UserSettings, err = newUserSettingsEndpoint(respData.UserSettingsEndpoint)
-	if err != nil && err.Error() == "not_found" {
-		err = nil
-	}
-	if respData.NotificationsEndpoint != "" {
-		server.Notifications = newNotificationsEndpoint(respData.NotificationsEndpoint)
-		server.Calendars = newCalendarsEndpoint(respData.NotificationsEndpoint + "/calendars")
-	}
-	if respData.ProfilesEndpoint != "" {
-		server.ProfilesAndTemplates = newProfilesAndTemplatesEndpoint(respData.ProfilesEndpoint)
-	}
-	return server, err
+		ServerMetadata: metadata,
+		AccessToken:    newAccessTokenEndpoint(c.endpointURL(EndpointAccessToken, metadata.AccessTokenEndpoint), c),
+		Mytoken: newMytokenEndpoint(
+			c.endpointURL(EndpointMytoken, metadata.MytokenEndpoint),
+			c.derivedEndpointURL(
+				EndpointMytokenTags, EndpointMytoken, metadata.MytokenEndpoint,
+				derivedPath(EndpointMytokenTags, metadata),
+			), c,
+		),
+		Revocation: newRevocationEndpoint(c.endpointURL(EndpointRevocation, metadata.RevocationEndpoint), c),
+		Tokeninfo:  newTokeninfoEndpoint(c.endpointURL(EndpointTokeninfo, metadata.TokeninfoEndpoint), c),
+		Transfer:   newTransferEndpoint(c.endpointURL(EndpointTransfer, metadata.TokenTransferEndpoint), c),
+		UserSettings: newUserSettingsEndpoint(
+			c.endpointURL(EndpointUserSettings, metadata.UserSettingsEndpoint), c,
+		),
+		url:    url,
+		client: c,
+	}
+	if c.available(EndpointNotifications, metadata.NotificationsEndpoint) {
+		server.Notifications = newNotificationsEndpoint(notifications, c)
+	}
+	if server.Notifications != nil || c.available(EndpointCalendars, "") {
+		calendars := notifications.derive(EndpointCalendars, derivedPath(EndpointCalendars, metadata))
+		server.Calendars = newCalendarsEndpoint(calendars, c)
+	}
+	if c.available(EndpointProfiles, metadata.ProfilesEndpoint) {
+		server.ProfilesAndTemplates = newProfilesAndTemplatesEndpoint(profiles, c)
+	}
+	// the UserSettings might be replaced with one that already knows its metadata, see RestoreMytokenServer
+	c.settingsMetadata = func() (api.SettingsMetaData, error) {
+		return server.UserSettings.MetaData()
+	}
+	return server
+}
+
+// serializedMytokenServer is the serialised form of a MytokenServer
+type serializedMytokenServer struct {
+	URL              string                   `json:"url"`
+	ServerMetadata   api.MytokenConfiguration `json:"server_metadata"`
+	SettingsMetadata *api.SettingsMetaData    `json:"settings_metadata,omitempty"`
+}
+
+// MarshalJSON implements the json.Marshaler interface; it serialises the server url and the discovered metadata
+func (s *MytokenServer) MarshalJSON() ([]byte, error) {
+	ser := serializedMytokenServer{
+		URL:            s.url,
+		ServerMetadata: s.ServerMetadata,
+	}
+	if m, ok := s.UserSettings.knownMetaData(); ok {
+		ser.SettingsMetadata = &m
+	}
+	return json.Marshal(ser)
+}
+
+// RestoreMytokenServer restores a MytokenServer serialised with json.Marshal without performing a discovery; the
+// passed options configure the restored server as in NewMytokenServerWithOptions
+func RestoreMytokenServer(data []byte, opts ...Option) (*MytokenServer, error) {
+	var ser serializedMytokenServer
+	if err := json.Unmarshal(data, &ser); err != nil {
+		return nil, newMytokenErrorFromError("could not restore mytoken server", err)
+	}
+	c, err := newClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	server, err := newMytokenServerFromMetadata(ser.URL, ser.ServerMetadata, c)
+	if err != nil {
+		return nil, err
+	}
+	if ser.SettingsMetadata != nil {
+		server.UserSettings = newUserSettingsEndpointFromMetadata(
+			c.endpointURL(EndpointUserSettings, ser.ServerMetadata.UserSettingsEndpoint), *ser.SettingsMetadata, c,
+		)
+	}
+	return server, nil
 }
@@ -1,13 +1,25 @@
 package mytokenlib
 
 import (
+	"sync"
+
 	"github.com/oidc-mytoken/api/v0"
 )
 
 // UserSettingsEndpoint is type representing a mytoken server's User Settings Endpoint and the actions that can be
 // performed there.
+// The api.SettingsMetaData is discovered lazily when it is first needed, i.e. when one of the sub-endpoints is used
+// or MetaData is called; a failed discovery is retried on the next use. It is safe for concurrent use.
+// The optional sub-endpoints Email and Tags are nil if it is known that the server does not support them and they are
+// not overridden with WithEndpointOverride, i.e. if the server has no user settings endpoint or if the
+// api.SettingsMetaData is already known without a discovery (see RestoreMytokenServer). Otherwise they are set, since
+// the support is only known after the discovery; use MytokenServer.Supports (e.g. with FeatureEmail or FeatureTags)
+// to check whether the server supports them. Requests to an unsupported sub-endpoint fail with an error matching
+// ErrUnsupportedByServer.
 type UserSettingsEndpoint struct {
 	endpoint    string
+	client      *client
+	mutex       sync.Mutex
 	metadata    api.SettingsMetaData
 	metadataSet bool
 	Grants      *GrantsEndpoint
@@ -15,43 +27,109 @@ type UserSettingsEndpoint struct {
 	Tags        *TagsSettingsEndpoint
 }
 
-func newUserSettingsEndpoint(endpoint string) (*UserSettingsEndpoint, error) {
+func newUserSettingsEndpoint(endpoint string, c *client) *UserSettingsEndpoint {
 	s := &UserSettingsEndpoint{
 		endpoint: endpoint,
+		client:   c,
+	}
+	s.Grants = newGrantsEndpoint(
+		s.subEndpoint(
+			EndpointGrants, func(m api.SettingsMetaData) string {
+				return m.GrantTypeEndpoint
+			},
+		), c,
+	)
+	if endpoint != "" || c.available(EndpointEmailSettings, "") {
+		s.Email = newEmailSettingsEndpoint(
+			s.subEndpoint(
+				EndpointEmailSettings, func(m api.SettingsMetaData) string {
+					return m.EmailEndpoint
+				},
+			), c,
+		)
 	}
-	if err := s.discover(); err != nil {
-		return nil, err
+	if endpoint != "" || c.available(EndpointTagsSettings, "") {
+		s.Tags = newTagsSettingsEndpoint(
+			s.subEndpoint(
+				EndpointTagsSettings, func(m api.SettingsMetaData) string {
+					return m.TagsEndpoint
+				},
+			), c,
+		)
 	}
-	s.Grants = newGrantsEndpoint(s.metadata.GrantTypeEndpoint)
-	if s.metadata.EmailEndpoint != "" {
-		s.Email = newEmailSettingsEndpoint(s.metadata.EmailEndpoint)
+	return s
+}
+
+// newUserSettingsEndpointFromMetadata creates a new UserSettingsEndpoint from already known api.SettingsMetaData
+// without performing a discovery
+func newUserSettingsEndpointFromMetadata(
+	endpoint string, metadata api.SettingsMetaData, c *client,
+) *UserSettingsEndpoint {
+	s := newUserSettingsEndpoint(endpoint, c)
+	s.metadata = metadata
+	s.metadataSet = true
+	if !c.available(EndpointEmailSettings, metadata.EmailEndpoint) {
+		s.Email = nil
 	}
-	if s.metadata.TagsEndpoint != "" {
-		s.Tags = newTagsSettingsEndpoint(s.metadata.TagsEndpoint)
+	if !c.available(EndpointTagsSettings, metadata.TagsEndpoint) {
+		s.Tags = nil
 	}
-	return s, nil
+	return s
+}
+
+// subEndpoint returns a lazyURL for a sub-endpoint whose url is taken from the api.SettingsMetaData by the passed
+// function
+func (s *UserSettingsEndpoint) subEndpoint(name EndpointName, get func(api.SettingsMetaData) string) *lazyURL {
+	return newLazyURL(
+		name, s.client, func() (string, error) {
+			m, err := s.MetaData()
+			if err != nil {
+				return "", err
+			}
+			url := get(m)
+			if url == "" {
+				return "", errEndpointUnsupported(string(name))
+			}
+			return url, nil
+		},
+	)
 }
 
 // DoHTTPRequest performs an http request to the user settings endpoint
-func (s UserSettingsEndpoint) DoHTTPRequest(method string, req, resp interface{}) error {
-	return doHTTPRequest(method, s.endpoint, req, resp)
+func (s *UserSettingsEndpoint) DoHTTPRequest(method string, req, resp interface{}) error {
+	if s.endpoint == "" {
+		return errEndpointUnsupported("user settings")
+	}
+	return s.client.doHTTPRequest(method, s.endpoint, req, resp)
 }
 
 func (s *UserSettingsEndpoint) discover() error {
-	err := s.DoHTTPRequest("GET", nil, &s.metadata)
-	if err != nil {
-		s.metadataSet = false
+	if s.endpoint == "" {
+		return errEndpointUnsupported("user settings")
+	}
+	var metadata api.SettingsMetaData
+	if err := s.client.discover(s.endpoint, &metadata); err != nil {
 		return err
 	}
+	s.metadata = metadata
 	s.metadataSet = true
 	return nil
 }
 
-// MetaData returns the user settings endpoint's api.SettingsMetaData
-func (s UserSettingsEndpoint) MetaData() (api.SettingsMetaData, error) {
+// MetaData returns the user settings endpoint's api.SettingsMetaData; it is discovered if it is not yet known
+func (s *UserSettingsEndpoint) MetaData() (api.SettingsMetaData, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	var err error
 	if !s.metadataSet {
 		err = s.discover()
 	}
 	return s.metadata, err
 }
+
+// knownMetaData returns the api.SettingsMetaData if it was already discovered, without performing a discovery
+func (s *UserSettingsEndpoint) knownMetaData() (api.SettingsMetaData, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.metadata, s.metadataSet
+}
@@ -6,11 +6,15 @@ import (
 
 // EmailSettingsEndpoint is type representing a mytoken server's Email Settings Endpoint
 type EmailSettingsEndpoint struct {
-	endpoint string
+	endpoint *lazyURL
+	client   *client
 }
 
-func newEmailSettingsEndpoint(endpoint string) *EmailSettingsEndpoint {
-	return &EmailSettingsEndpoint{endpoint: endpoint}
+func newEmailSettingsEndpoint(endpoint *lazyURL, c *client) *EmailSettingsEndpoint {
+	return &EmailSettingsEndpoint{
+		endpoint: endpoint,
+		client:   c,
+	}
 }
 
 // APIGet retrieves the user's email settings information
@@ -34,10 +38,17 @@ func (e EmailSettingsEndpoint) APIUpdate(mytoken, emailAddress string, preferHTM
 
 // DoHTTPRequest performs an http request to the email settings endpoint
 func (e EmailSettingsEndpoint) DoHTTPRequest(method string, req, resp interface{}) error {
-	return doHTTPRequest(method, e.endpoint, req, resp)
+	return e.DoHTTPRequestWithAuth(method, req, resp, "")
 }
 
 // DoHTTPRequestWithAuth performs an http request to the email settings endpoint with mytoken authorization
 func (e EmailSettingsEndpoint) DoHTTPRequestWithAuth(method string, req, resp interface{}, mytoken string) error {
-	return doHTTPRequestWithAuth(method, e.endpoint, req, resp, mytoken)
+	if err := e.client.requireFeature(FeatureEmail, EndpointEmailSettings, EndpointUserSettings); err != nil {
+		return err
+	}
+	url, err := e.endpoint.get()
+	if err != nil {
+		return err
+	}
+	return e.client.doHTTPRequestWithAuth(method, url, req, resp, mytoken)
 }
@@ -6,11 +6,15 @@ import (
 
 // TagsSettingsEndpoint is type representing a mytoken server's Tags Settings Endpoint
 type TagsSettingsEndpoint struct {
-	endpoint string
+	endpoint *lazyURL
+	client   *client
 }
 
-func newTagsSettingsEndpoint(endpoint string) *TagsSettingsEndpoint {
-	return &TagsSettingsEndpoint{endpoint: endpoint}
+func newTagsSettingsEndpoint(endpoint *lazyURL, c *client) *TagsSettingsEndpoint {
+	return &TagsSettingsEndpoint{
+		endpoint: endpoint,
+		client:   c,
+	}
 }
 
 // APIGet retrieves the user's tags
@@ -25,8 +29,7 @@ func (t TagsSettingsEndpoint) APICreate(mytoken, tagName, color string) (err err
 	if color != "" {
 		req["color"] = color
 	}
-	url := t.endpoint + "/" + tagName
-	err = doHTTPRequestWithAuth("POST", url, req, nil, mytoken)
+	err = t.doHTTPRequestWithAuthForTag(tagName, "POST", req, nil, mytoken)
 	return
 }
 
@@ -39,24 +42,44 @@ func (t TagsSettingsEndpoint) APIUpdate(mytoken, tagName, newTagName, color stri
 	if color != "" {
 		req["color"] = color
 	}
-	url := t.endpoint + "/" + tagName
-	err = doHTTPRequestWithAuth("PUT", url, req, &resp, mytoken)
+	err = t.doHTTPRequestWithAuthForTag(tagName, "PUT", req, &resp, mytoken)
 	return
 }
 
 // APIDelete deletes a tag
 func (t TagsSettingsEndpoint) APIDelete(mytoken, tagName string) (resp api.OnlyTokenUpdateResponse, err error) {
-	url := t.endpoint + "/" + tagName
-	err = doHTTPRequestWithAuth("DELETE", url, nil, &resp, mytoken)
+	err = t.doHTTPRequestWithAuthForTag(tagName, "DELETE", nil, &resp, mytoken)
 	return
 }
 
 // DoHTTPRequest performs an http request to the tags settings endpoint
 func (t TagsSettingsEndpoint) DoHTTPRequest(method string, req, resp interface{}) error {
-	return doHTTPRequest(method, t.endpoint, req, resp)
+	return t.DoHTTPRequestWithAuth(method, req, resp, "")
 }
 
 // DoHTTPRequestWithAuth performs an http request to the tags settings endpoint with mytoken authorization
 func (t TagsSettingsEndpoint) DoHTTPRequestWithAuth(method string, req, resp interface{}, mytoken string) error {
-	return doHTTPRequestWithAuth(method, t.endpoint, req, resp, mytoken)
+	return t.doHTTPRequestWithAuthAt("", method, req, resp, mytoken)
+}
+
+// doHTTPRequestWithAuthForTag performs an http request for the passed tag with mytoken authorization
+func (t TagsSettingsEndpoint) doHTTPRequestWithAuthForTag(
+	tagName, method string, req, resp interface{}, mytoken string,
+) error {
+	return t.doHTTPRequestWithAuthAt("/"+tagName, method, req, resp, mytoken)
+}
+
+// doHTTPRequestWithAuthAt performs an http request to the passed path below the tags settings endpoint with mytoken
+// authorization
+func (t TagsSettingsEndpoint) doHTTPRequestWithAuthAt(
+	path, method string, req, resp interface{}, mytoken string,
+) error {
+	if err := t.client.requireFeature(FeatureTags, EndpointTagsSettings, EndpointUserSettings); err != nil {
+		return err
+	}
+	url, err := t.endpoint.get()
+	if err != nil {
+		return err
+	}
+	return t.client.doHTTPRequestWithAuth(method, url+path, req, resp, mytoken)
 }
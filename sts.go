@@ -0,0 +1,195 @@
+package mytokenlib
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	stsActionAssumeRoleWithWebIdentity = "AssumeRoleWithWebIdentity"
+	stsAPIVersion                      = "2011-06-15"
+	// stsExpiryMargin is the duration before their expiration at which cached credentials are considered expired
+	stsExpiryMargin = time.Minute
+	// stsMaxResponseSize limits the size of responses read from the sts endpoint
+	stsMaxResponseSize = 1 << 20
+)
+
+// STSCredentials are temporary credentials obtained from an AWS-compatible Security Token Service
+type STSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      time.Time
+}
+
+// STSCredentialsProvider obtains temporary credentials by exchanging access tokens from an AccessTokenSource at an
+// AWS-compatible Security Token Service (e.g. AWS STS or MinIO) using AssumeRoleWithWebIdentity. Credentials are
+// cached until they are about to expire and refreshed transparently. It is safe for concurrent use.
+type STSCredentialsProvider struct {
+	// RoleARN is the ARN of the role to assume; it may be empty for services that do not require it, e.g. MinIO
+	RoleARN string
+	// RoleSessionName is the name of the session; if empty, "mytoken" is used
+	RoleSessionName string
+	// Duration is the requested lifetime of the credentials; if 0, the STS default is used
+	Duration time.Duration
+	// HTTPClient is the http.Client used to talk to the STS; if nil, the http.Client, user agent, and timeout of the
+	// MytokenServer the AccessTokenSource obtains its access tokens from are used
+	HTTPClient *http.Client
+
+	endpoint string
+	source   *AccessTokenSource
+
+	mutex       sync.Mutex
+	credentials STSCredentials
+}
+
+// NewSTSCredentialsProvider creates a new STSCredentialsProvider that exchanges access tokens from the passed
+// AccessTokenSource at the passed STS endpoint
+func NewSTSCredentialsProvider(source *AccessTokenSource, stsEndpoint, roleARN string) *STSCredentialsProvider {
+	return &STSCredentialsProvider{
+		RoleARN:  roleARN,
+		endpoint: stsEndpoint,
+		source:   source,
+	}
+}
+
+// Retrieve returns valid STSCredentials; cached credentials are returned if they are not about to expire, otherwise
+// new credentials are obtained
+func (p *STSCredentialsProvider) Retrieve(ctx context.Context) (STSCredentials, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if !p.isExpired() {
+		return p.credentials, nil
+	}
+	creds, err := p.assumeRole(ctx)
+	if err != nil {
+		return STSCredentials{}, err
+	}
+	p.credentials = creds
+	return creds, nil
+}
+
+// IsExpired returns true if there are no cached credentials or they are about to expire
+func (p *STSCredentialsProvider) IsExpired() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.isExpired()
+}
+
+func (p *STSCredentialsProvider) isExpired() bool {
+	return p.credentials.AccessKeyID == "" || p.source.clock().Now().Add(stsExpiryMargin).After(p.credentials.Expiration)
+}
+
+type stsAssumeRoleResponse struct {
+	Result struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"Credentials"`
+	} `xml:"AssumeRoleWithWebIdentityResult"`
+}
+
+type stsErrorResponse struct {
+	Error struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	} `xml:"Error"`
+}
+
+// serverClient returns the client of the MytokenServer the AccessTokenSource obtains its access tokens from; it is nil
+// if the AccessTokenSource has no AccessTokenEndpoint
+func (p *STSCredentialsProvider) serverClient() *client {
+	if p.source.endpoint == nil {
+		return nil
+	}
+	return p.source.endpoint.client
+}
+
+func (p *STSCredentialsProvider) assumeRole(ctx context.Context) (STSCredentials, error) {
+	token, err := p.source.Token()
+	if err != nil {
+		return STSCredentials{}, err
+	}
+	sessionName := p.RoleSessionName
+	if sessionName == "" {
+		sessionName = "mytoken"
+	}
+	form := url.Values{
+		"Action":           {stsActionAssumeRoleWithWebIdentity},
+		"Version":          {stsAPIVersion},
+		"RoleSessionName":  {sessionName},
+		"WebIdentityToken": {token},
+	}
+	if p.RoleARN != "" {
+		form.Set("RoleArn", p.RoleARN)
+	}
+	if p.Duration > 0 {
+		form.Set("DurationSeconds", strconv.Itoa(int(p.Duration/time.Second)))
+	}
+	serverClient := p.serverClient()
+	if serverClient != nil && serverClient.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, serverClient.timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", p.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return STSCredentials{}, newMytokenErrorFromError(errSendingHttpRequest, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if ua := serverClient.getUserAgent(); ua != "" {
+		req.Header.Set("User-Agent", ua)
+	}
+	client := p.HTTPClient
+	if client == nil {
+		client = serverClient.getHTTPClient()
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return STSCredentials{}, newMytokenErrorFromError(errSendingHttpRequest, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, stsMaxResponseSize))
+	if err != nil {
+		return STSCredentials{}, newMytokenErrorFromError(errDecodingHttpResponse, err)
+	}
+	if resp.StatusCode >= 400 {
+		var stsErr stsErrorResponse
+		if err = xml.Unmarshal(body, &stsErr); err != nil || stsErr.Error.Code == "" {
+			return STSCredentials{}, MytokenError{
+				err:          "sts error",
+				errorDetails: resp.Status,
+			}
+		}
+		return STSCredentials{}, MytokenError{
+			err:          stsErr.Error.Code,
+			errorDetails: stsErr.Error.Message,
+		}
+	}
+	var stsResp stsAssumeRoleResponse
+	if err = xml.Unmarshal(body, &stsResp); err != nil {
+		return STSCredentials{}, newMytokenErrorFromError(errDecodingHttpResponse, err)
+	}
+	c := stsResp.Result.Credentials
+	if c.AccessKeyID == "" {
+		return STSCredentials{}, MytokenError{
+			err:          errDecodingHttpResponse,
+			errorDetails: "no credentials in sts response",
+		}
+	}
+	return STSCredentials{
+		AccessKeyID:     c.AccessKeyID,
+		SecretAccessKey: c.SecretAccessKey,
+		SessionToken:    c.SessionToken,
+		Expiration:      c.Expiration,
+	}, nil
+}
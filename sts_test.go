@@ -0,0 +1,160 @@
+package mytokenlib
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSTSCredentialsProvider(t *testing.T) {
+	start := time.Now().Truncate(time.Second)
+	clock := NewFakeClock(start)
+	var issued atomic.Int32
+	server := newTestMytokenServer(t, accessTokenHandler(3600, &issued), nil, WithClock(clock))
+	source := NewAccessTokenSource(server.AccessToken, "mytoken", "", nil, nil, "")
+
+	var calls atomic.Int32
+	sts := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				n := calls.Add(1)
+				if err := r.ParseForm(); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				if r.Form.Get("Action") != stsActionAssumeRoleWithWebIdentity ||
+					r.Form.Get("WebIdentityToken") != "at1" || r.Form.Get("RoleArn") != "arn:role" ||
+					r.Form.Get("DurationSeconds") != "900" || r.Form.Get("RoleSessionName") != "mytoken" {
+					w.WriteHeader(http.StatusForbidden)
+					_, _ = fmt.Fprintf(
+						w, "<ErrorResponse><Error><Code>AccessDenied</Code><Message>%s</Message></Error>"+
+							"</ErrorResponse>", r.Form.Encode(),
+					)
+					return
+				}
+				_, _ = fmt.Fprintf(
+					w, "<AssumeRoleWithWebIdentityResponse><AssumeRoleWithWebIdentityResult><Credentials>"+
+						"<AccessKeyId>key%d</AccessKeyId><SecretAccessKey>secret</SecretAccessKey>"+
+						"<SessionToken>session</SessionToken><Expiration>%s</Expiration>"+
+						"</Credentials></AssumeRoleWithWebIdentityResult></AssumeRoleWithWebIdentityResponse>",
+					n, clock.Now().Add(15*time.Minute).UTC().Format(time.RFC3339),
+				)
+			},
+		),
+	)
+	defer sts.Close()
+
+	provider := NewSTSCredentialsProvider(source, sts.URL, "arn:role")
+	provider.Duration = 15 * time.Minute
+	if !provider.IsExpired() {
+		t.Error("expected a provider without credentials to be expired")
+	}
+	creds, err := provider.Retrieve(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := STSCredentials{
+		AccessKeyID:     "key1",
+		SecretAccessKey: "secret",
+		SessionToken:    "session",
+		Expiration:      start.Add(15 * time.Minute).UTC(),
+	}
+	if creds != expected {
+		t.Fatalf("expected %+v, got %+v", expected, creds)
+	}
+
+	// the credentials are cached until they are about to expire
+	clock.Advance(15*time.Minute - stsExpiryMargin)
+	if creds, err = provider.Retrieve(context.Background()); err != nil || creds.AccessKeyID != "key1" {
+		t.Errorf("expected the cached credentials, got %+v, %v", creds, err)
+	}
+	clock.Advance(time.Second)
+	if !provider.IsExpired() {
+		t.Error("expected the credentials to be expired within the expiry margin")
+	}
+	if creds, err = provider.Retrieve(context.Background()); err != nil || creds.AccessKeyID != "key2" {
+		t.Errorf("expected new credentials, got %+v, %v", creds, err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("expected 2 sts requests, got %d", n)
+	}
+}
+
+func TestSTSCredentialsProviderError(t *testing.T) {
+	var issued atomic.Int32
+	server := newTestMytokenServer(t, accessTokenHandler(3600, &issued), nil)
+	source := NewAccessTokenSource(server.AccessToken, "mytoken", "", nil, nil, "")
+	sts := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = fmt.Fprint(
+					w, "<ErrorResponse><Error><Code>InvalidIdentityToken</Code><Message>token expired</Message>"+
+						"</Error></ErrorResponse>",
+				)
+			},
+		),
+	)
+	defer sts.Close()
+
+	_, err := NewSTSCredentialsProvider(source, sts.URL, "").Retrieve(context.Background())
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	expected := MytokenError{
+		err:          "InvalidIdentityToken",
+		errorDetails: "token expired",
+	}
+	if err.Error() != expected.Error() {
+		t.Errorf("expected the error %q, got %q", expected.Error(), err.Error())
+	}
+}
+
+func TestSTSCredentialsProviderUsesServerClient(t *testing.T) {
+	var stsRequests atomic.Int32
+	var stsUserAgent atomic.Value
+	sts := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				stsUserAgent.Store(r.UserAgent())
+				_, _ = fmt.Fprintf(
+					w, "<AssumeRoleWithWebIdentityResponse><AssumeRoleWithWebIdentityResult><Credentials>"+
+						"<AccessKeyId>key</AccessKeyId><Expiration>%s</Expiration>"+
+						"</Credentials></AssumeRoleWithWebIdentityResult></AssumeRoleWithWebIdentityResponse>",
+					time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+				)
+			},
+		),
+	)
+	defer sts.Close()
+	// the client of the mytoken server counts the requests sent to the sts
+	httpClient := &http.Client{
+		Transport: roundTripFunc(
+			func(r *http.Request) (*http.Response, error) {
+				if "http://"+r.URL.Host == sts.URL {
+					stsRequests.Add(1)
+				}
+				return http.DefaultTransport.RoundTrip(r)
+			},
+		),
+	}
+	var issued atomic.Int32
+	server := newTestMytokenServer(
+		t, accessTokenHandler(3600, &issued), nil, WithHTTPClient(httpClient), WithUserAgent("sts-test"),
+	)
+	source := NewAccessTokenSource(server.AccessToken, "mytoken", "", nil, nil, "")
+
+	if _, err := NewSTSCredentialsProvider(source, sts.URL, "").Retrieve(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n := stsRequests.Load(); n != 1 {
+		t.Errorf("expected the sts request to be sent with the server's http client, it sent %d requests", n)
+	}
+	if ua := stsUserAgent.Load(); ua != "sts-test" {
+		t.Errorf("expected the server's user agent, got %q", ua)
+	}
+}
@@ -0,0 +1,185 @@
+package mytokenlib
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+// ErrPublicKeyPinMismatch is returned if the tls connection to the server is rejected because none of the public
+// keys of the server's certificate chain matches the pinned public keys, see WithPinnedPublicKeys. Use errors.Is to
+// check for it.
+var ErrPublicKeyPinMismatch = MytokenError{err: "public key pin mismatch"}
+
+// pinPrefix is the optional prefix of public key pins
+const pinPrefix = "sha256/"
+
+// tlsSettings holds the tls settings configured through options; they are applied to the transport of the
+// http.Client once all options are applied
+type tlsSettings struct {
+	pins         [][]byte
+	rootCAs      *x509.CertPool
+	certificates []tls.Certificate
+}
+
+func (c *client) tlsSettings() *tlsSettings {
+	if c.tls == nil {
+		c.tls = &tlsSettings{}
+	}
+	return c.tls
+}
+
+// WithPinnedPublicKeys pins the public keys of the server's tls certificates. A pin is the base64 encoded SHA-256
+// hash of a DER encoded SubjectPublicKeyInfo, optionally prefixed with "sha256/", e.g. as obtained with
+//
+//	openssl x509 -in cert.pem -pubkey -noout | openssl pkey -pubin -outform der | openssl dgst -sha256 -binary | base64
+//
+// A connection is only accepted if the public key of at least one certificate of the verified certificate chain
+// matches one of the pins, so multiple pins can be passed, e.g. for backup keys or to pin the key of an intermediate
+// CA. Otherwise, requests fail with an error matching ErrPublicKeyPinMismatch that lists the server's pins.
+// The normal certificate verification is still performed. Like the other tls options, this option requires the
+// http.Client (see WithHTTPClient and SetClient) to use an *http.Transport; its transport is cloned when the
+// MytokenServer is created.
+func WithPinnedPublicKeys(pins ...string) Option {
+	return func(c *client) error {
+		for _, pin := range pins {
+			hash, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(strings.TrimSpace(pin), pinPrefix))
+			if err != nil || len(hash) != sha256.Size {
+				return MytokenError{
+					err:          "invalid public key pin",
+					errorDetails: "'" + pin + "' is not a base64 encoded SHA-256 hash",
+				}
+			}
+			c.tlsSettings().pins = append(c.tlsSettings().pins, hash)
+		}
+		return nil
+	}
+}
+
+// WithCABundle trusts the PEM encoded CA certificates in the passed file in addition to the system's CA certificates
+func WithCABundle(path string) Option {
+	return func(c *client) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return newMytokenErrorFromError("could not read ca bundle", err)
+		}
+		settings := c.tlsSettings()
+		if settings.rootCAs == nil {
+			if settings.rootCAs, err = x509.SystemCertPool(); err != nil {
+				settings.rootCAs = x509.NewCertPool()
+			}
+		}
+		if !settings.rootCAs.AppendCertsFromPEM(data) {
+			return MytokenError{
+				err:          "could not read ca bundle",
+				errorDetails: "no PEM encoded certificates found in " + path,
+			}
+		}
+		return nil
+	}
+}
+
+// WithClientCertificate sets a client certificate for mutual tls authentication; the certificate and its private key
+// are loaded from the passed PEM encoded files
+func WithClientCertificate(certFile, keyFile string) Option {
+	return func(c *client) error {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return newMytokenErrorFromError("could not load client certificate", err)
+		}
+		c.tlsSettings().certificates = append(c.tlsSettings().certificates, cert)
+		return nil
+	}
+}
+
+// publicKeyPin returns the pin of the public key of the passed certificate
+func publicKeyPin(cert *x509.Certificate) []byte {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hash[:]
+}
+
+// verifyPins checks that a public key of the verified certificate chain matches one of the pins
+func (s *tlsSettings) verifyPins(state tls.ConnectionState) error {
+	certs := state.PeerCertificates
+	if len(state.VerifiedChains) > 0 {
+		certs = nil
+		for _, chain := range state.VerifiedChains {
+			certs = append(certs, chain...)
+		}
+	}
+	var presented []string
+	for _, cert := range certs {
+		pin := publicKeyPin(cert)
+		for _, p := range s.pins {
+			if string(p) == string(pin) {
+				return nil
+			}
+		}
+		encoded := pinPrefix + base64.StdEncoding.EncodeToString(pin)
+		if !slices.Contains(presented, encoded) {
+			presented = append(presented, encoded)
+		}
+	}
+	server := "the server"
+	if state.ServerName != "" {
+		server = "'" + state.ServerName + "'"
+	}
+	return MytokenError{
+		err: ErrPublicKeyPinMismatch.err,
+		errorDetails: fmt.Sprintf(
+			"no public key of the certificate chain of %s matches the pinned keys; the chain has the keys %s",
+			server, strings.Join(presented, ", "),
+		),
+	}
+}
+
+// applyTLSSettings applies the configured tls settings to a clone of the http.Client's transport
+func (c *client) applyTLSSettings() error {
+	if c.tls == nil {
+		return nil
+	}
+	base := c.getHTTPClient()
+	var transport *http.Transport
+	switch t := base.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		return MytokenError{
+			err:          "could not apply tls settings",
+			errorDetails: fmt.Sprintf("the http client's transport is a %T, not an *http.Transport", t),
+		}
+	}
+	config := transport.TLSClientConfig
+	if config == nil {
+		config = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if c.tls.rootCAs != nil {
+		config.RootCAs = c.tls.rootCAs
+	}
+	config.Certificates = append(config.Certificates, c.tls.certificates...)
+	if len(c.tls.pins) > 0 {
+		verify := config.VerifyConnection
+		settings := c.tls
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			if verify != nil {
+				if err := verify(state); err != nil {
+					return err
+				}
+			}
+			return settings.verifyPins(state)
+		}
+	}
+	transport.TLSClientConfig = config
+	httpClient := *base
+	httpClient.Transport = transport
+	c.httpClient = &httpClient
+	return nil
+}
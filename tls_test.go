@@ -0,0 +1,154 @@
+package mytokenlib
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oidc-mytoken/api/v0"
+)
+
+// testPin returns the public key pin of the passed certificate, see WithPinnedPublicKeys
+func testPin(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return pinPrefix + base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// writePEMFile writes the passed PEM block to a file in a temporary directory
+func writePEMFile(t *testing.T, name string, block *pem.Block) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeTestClientCertificate creates a self-signed client certificate and writes it and its key to PEM files
+func writeTestClientCertificate(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "mytoken-test-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile = writePEMFile(t, "client.pem", &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyFile = writePEMFile(t, "client.key", &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return
+}
+
+func TestPinnedPublicKeys(t *testing.T) {
+	srv := newTestTLSServer(
+		t, func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, api.AccessTokenResponse{AccessToken: "at"})
+		}, nil,
+	)
+	pin := testPin(srv.Certificate())
+	otherPin := pinPrefix + base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+
+	server, err := NewMytokenServerWithOptions(
+		srv.URL, WithHTTPClient(srv.Client()), WithPinnedPublicKeys(otherPin, pin),
+	)
+	if err != nil {
+		t.Fatalf("expected a matching pin to be accepted, got %s", err)
+	}
+	if _, err = server.AccessToken.APIGet("mytoken", "", nil, nil, ""); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	_, err = NewMytokenServerWithOptions(srv.URL, WithHTTPClient(srv.Client()), WithPinnedPublicKeys(otherPin))
+	if !errors.Is(err, ErrPublicKeyPinMismatch) {
+		t.Fatalf("expected ErrPublicKeyPinMismatch, got %v", err)
+	}
+
+	if _, err = NewMytokenServerWithOptions(srv.URL, WithPinnedPublicKeys("not a pin")); err == nil {
+		t.Error("expected an invalid pin to be rejected")
+	}
+}
+
+func TestTLSSettingsRequireHTTPTransport(t *testing.T) {
+	srv := newTestTLSServer(t, nil, nil)
+	httpClient := &http.Client{Transport: roundTripFunc(srv.Client().Transport.RoundTrip)}
+	_, err := NewMytokenServerWithOptions(
+		srv.URL, WithHTTPClient(httpClient), WithPinnedPublicKeys(testPin(srv.Certificate())),
+	)
+	if err == nil {
+		t.Fatal("expected tls settings to be rejected for a transport that is not an *http.Transport")
+	}
+	// without tls settings any transport can be used
+	if _, err = NewMytokenServerWithOptions(srv.URL, WithHTTPClient(httpClient)); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestCABundle(t *testing.T) {
+	srv := newTestTLSServer(t, nil, nil)
+	if _, err := NewMytokenServerWithOptions(srv.URL); err == nil {
+		t.Fatal("expected the self-signed test certificate not to be trusted by default")
+	}
+	bundle := writePEMFile(t, "ca.pem", &pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if _, err := NewMytokenServerWithOptions(srv.URL, WithCABundle(bundle)); err != nil {
+		t.Errorf("expected the certificate from the ca bundle to be trusted, got %s", err)
+	}
+	missing := filepath.Join(t.TempDir(), "missing.pem")
+	if _, err := NewMytokenServerWithOptions(srv.URL, WithCABundle(missing)); err == nil {
+		t.Error("expected a missing ca bundle to be rejected")
+	}
+}
+
+func TestClientCertificate(t *testing.T) {
+	srv := httptest.NewUnstartedServer(nil)
+	srv.Config.Handler = testServerHandler(
+		srv, func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, api.AccessTokenResponse{AccessToken: "at"})
+		}, nil,
+	)
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	if _, err := NewMytokenServerWithOptions(srv.URL, WithHTTPClient(srv.Client())); err == nil {
+		t.Fatal("expected the server to reject requests without client certificate")
+	}
+	certFile, keyFile := writeTestClientCertificate(t)
+	server, err := NewMytokenServerWithOptions(
+		srv.URL, WithHTTPClient(srv.Client()), WithClientCertificate(certFile, keyFile),
+	)
+	if err != nil {
+		t.Fatalf("could not create mytoken server: %s", err)
+	}
+	if _, err = server.AccessToken.APIGet("mytoken", "", nil, nil, ""); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if _, err = NewMytokenServerWithOptions(srv.URL, WithClientCertificate(keyFile, certFile)); err == nil {
+		t.Error("expected an invalid client certificate to be rejected")
+	}
+}
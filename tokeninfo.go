@@ -8,17 +8,30 @@ import (
 // performed there.
 type TokeninfoEndpoint struct {
 	endpoint string
+	client   *client
 }
 
-func newTokeninfoEndpoint(endpoint string) *TokeninfoEndpoint {
+func newTokeninfoEndpoint(endpoint string, c *client) *TokeninfoEndpoint {
 	return &TokeninfoEndpoint{
 		endpoint: endpoint,
+		client:   c,
 	}
 }
 
 // DoHTTPRequest performs an http request to the tokeninfo endpoint
 func (info TokeninfoEndpoint) DoHTTPRequest(method string, req, resp interface{}) error {
-	return doHTTPRequest(method, info.endpoint, req, resp)
+	if info.endpoint == "" {
+		return errEndpointUnsupported("tokeninfo")
+	}
+	return info.client.doHTTPRequest(method, info.endpoint, req, resp)
+}
+
+// doAction performs the passed tokeninfo request, if the server supports its action
+func (info TokeninfoEndpoint) doAction(req api.TokenInfoRequest, resp interface{}) error {
+	if err := info.client.requireTokeninfoAction(req.Action); err != nil {
+		return err
+	}
+	return info.DoHTTPRequest("POST", req, resp)
 }
 
 // Introspect introspects the passed mytoken
@@ -28,7 +41,7 @@ func (info TokeninfoEndpoint) Introspect(mytoken string) (*api.TokeninfoIntrospe
 		Mytoken: mytoken,
 	}
 	var resp api.TokeninfoIntrospectResponse
-	if err := info.DoHTTPRequest("POST", req, &resp); err != nil {
+	if err := info.doAction(req, &resp); err != nil {
 		return nil, err
 	}
 	return &resp, nil
@@ -44,7 +57,7 @@ func (info TokeninfoEndpoint) APIHistory(mytoken string, momIDs ...string) (
 		Mytoken: mytoken,
 		MOMIDs:  momIDs,
 	}
-	err = info.DoHTTPRequest("POST", req, &resp)
+	err = info.doAction(req, &resp)
 	return
 }
 
@@ -83,7 +96,7 @@ func (info TokeninfoEndpoint) APISubtokens(mytoken string) (resp api.TokeninfoSu
 		Action:  api.TokeninfoActionSubtokens,
 		Mytoken: mytoken,
 	}
-	err = info.DoHTTPRequest("POST", req, &resp)
+	err = info.doAction(req, &resp)
 	return
 }
 
@@ -109,7 +122,7 @@ func (info TokeninfoEndpoint) APIListMytokens(mytoken string) (resp api.Tokeninf
 		Action:  api.TokeninfoActionListMytokens,
 		Mytoken: mytoken,
 	}
-	err = info.DoHTTPRequest("POST", req, &resp)
+	err = info.doAction(req, &resp)
 	return
 }
 
@@ -137,6 +150,6 @@ func (info TokeninfoEndpoint) APINotifications(mytoken string, momIDs []string)
 		Mytoken: mytoken,
 		MOMIDs:  momIDs,
 	}
-	err = info.DoHTTPRequest("POST", req, &resp)
+	err = info.doAction(req, &resp)
 	return
 }
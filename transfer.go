@@ -8,17 +8,22 @@ import (
 // performed there.
 type TransferEndpoint struct {
 	endpoint string
+	client   *client
 }
 
-func newTransferEndpoint(endpoint string) *TransferEndpoint {
+func newTransferEndpoint(endpoint string, c *client) *TransferEndpoint {
 	return &TransferEndpoint{
 		endpoint: endpoint,
+		client:   c,
 	}
 }
 
 // DoHTTPRequest performs an http request to the token transfer endpoint
 func (t TransferEndpoint) DoHTTPRequest(method string, req, resp interface{}) error {
-	return doHTTPRequest(method, t.endpoint, req, resp)
+	if t.endpoint == "" {
+		return errEndpointUnsupported("token transfer")
+	}
+	return t.client.doHTTPRequest(method, t.endpoint, req, resp)
 }
 
 // APICreate creates a new transfer code for the passed mytoken and returns the api response
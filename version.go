@@ -0,0 +1,288 @@
+package mytokenlib
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/oidc-mytoken/api/v0"
+)
+
+// SupportedAPIVersion is the version of the mytoken api this library implements, i.e. the version of the
+// github.com/oidc-mytoken/api types it uses
+const SupportedAPIVersion = 0
+
+// ErrIncompatibleServer is returned if the server is not compatible with this library, i.e. if it advertises another
+// api version than SupportedAPIVersion or if its responses cannot be decoded into the api types. Use errors.Is to
+// check for it.
+var ErrIncompatibleServer = MytokenError{err: "incompatible mytoken server"}
+
+// apiVersionPattern matches the api version in the path of an endpoint url, e.g. "/api/v0/"
+var apiVersionPattern = regexp.MustCompile(`/api/v(\d+)(/|$)`)
+
+// Version is a semantic version, e.g. of a mytoken server
+type Version struct {
+	Major      int
+	Minor      int
+	Patch      int
+	PreRelease string
+}
+
+// ParseVersion parses a version like "0.10.2", "v0.10.2", or "0.11.0-rc1"; missing minor and patch numbers are 0 and
+// build metadata (e.g. "+abc123") is ignored
+func ParseVersion(s string) (Version, error) {
+	invalid := MytokenError{
+		err:          "invalid version",
+		errorDetails: "'" + s + "' is not a semantic version",
+	}
+	core, _, _ := strings.Cut(strings.TrimPrefix(strings.TrimSpace(s), "v"), "+")
+	core, preRelease, _ := strings.Cut(core, "-")
+	parts := strings.Split(core, ".")
+	if len(parts) > 3 {
+		return Version{}, invalid
+	}
+	var numbers [3]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return Version{}, invalid
+		}
+		numbers[i] = n
+	}
+	return Version{
+		Major:      numbers[0],
+		Minor:      numbers[1],
+		Patch:      numbers[2],
+		PreRelease: preRelease,
+	}, nil
+}
+
+// String returns the string representation of the Version
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.PreRelease != "" {
+		s += "-" + v.PreRelease
+	}
+	return s
+}
+
+// AtLeast checks if this Version is the same or a newer version than the passed one; pre-releases are ordered as
+// defined by semantic versioning, i.e. a pre-release is older than the release with the same version numbers and
+// "rc10" is newer than "rc9"
+func (v Version) AtLeast(required Version) bool {
+	if v.Major != required.Major {
+		return v.Major > required.Major
+	}
+	if v.Minor != required.Minor {
+		return v.Minor > required.Minor
+	}
+	if v.Patch != required.Patch {
+		return v.Patch > required.Patch
+	}
+	return comparePreRelease(v.PreRelease, required.PreRelease) >= 0
+}
+
+// comparePreRelease compares two pre-release versions as defined by semantic versioning and returns -1, 0, or 1; an
+// empty pre-release is a release and newer than any pre-release
+func comparePreRelease(a, b string) int {
+	if a == b {
+		return 0
+	}
+	if a == "" {
+		return 1
+	}
+	if b == "" {
+		return -1
+	}
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if c := comparePreReleaseIdentifier(as[i], bs[i]); c != 0 {
+			return c
+		}
+	}
+	// if all identifiers are equal, the pre-release with more identifiers is newer
+	return cmp.Compare(len(as), len(bs))
+}
+
+// comparePreReleaseIdentifier compares two identifiers of a pre-release version: numeric identifiers are compared
+// numerically and are older than alphanumeric identifiers, which are compared lexically. Since servers often use
+// pre-releases like "rc9" instead of "rc.9", alphanumeric identifiers with the same prefix that end in a number are
+// compared by that number.
+func comparePreReleaseIdentifier(a, b string) int {
+	an, aErr := strconv.ParseUint(a, 10, 64)
+	bn, bErr := strconv.ParseUint(b, 10, 64)
+	switch {
+	case aErr == nil && bErr == nil:
+		return cmp.Compare(an, bn)
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	aPrefix, aNumber := splitTrailingNumber(a)
+	bPrefix, bNumber := splitTrailingNumber(b)
+	if aPrefix == bPrefix && aNumber != "" && bNumber != "" {
+		an, _ = strconv.ParseUint(aNumber, 10, 64)
+		bn, _ = strconv.ParseUint(bNumber, 10, 64)
+		if c := cmp.Compare(an, bn); c != 0 {
+			return c
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+// splitTrailingNumber splits the trailing digits off the passed identifier
+func splitTrailingNumber(s string) (prefix, number string) {
+	i := len(s)
+	for i > 0 && s[i-1] >= '0' && s[i-1] <= '9' {
+		i--
+	}
+	return s[:i], s[i:]
+}
+
+// Before checks if this Version is older than the passed one
+func (v Version) Before(before Version) bool {
+	return !v.AtLeast(before)
+}
+
+// ServerVersion returns the version of the mytoken server as advertised in its metadata; false is returned if the
+// server does not advertise a valid version.
+// The library barely switches its behaviour on the server version: the endpoint urls are taken from the metadata, and
+// optional endpoints, grant types, flows, and tokeninfo actions are checked against what the server advertises (see
+// MytokenServer.Supports). Only the urls of EndpointMytokenTags and EndpointCalendars are derived from other
+// endpoints; their paths are taken from a table of server and api versions (see derivedEndpointPaths). If a server
+// serves them at other paths, they can be set with WithEndpointOverride.
+func (s *MytokenServer) ServerVersion() (Version, bool) {
+	v, err := ParseVersion(s.ServerMetadata.Version)
+	return v, s.ServerMetadata.Version != "" && err == nil
+}
+
+// APIVersion returns the version of the mytoken api the server advertises through the paths of its endpoints, e.g. 0
+// for endpoints below "/api/v0/"; false is returned if the endpoints do not contain an api version
+func (s *MytokenServer) APIVersion() (int, bool) {
+	return apiVersion(s.ServerMetadata)
+}
+
+func apiVersion(metadata api.MytokenConfiguration) (int, bool) {
+	for _, endpoint := range []string{metadata.MytokenEndpoint, metadata.AccessTokenEndpoint} {
+		if m := apiVersionPattern.FindStringSubmatch(endpoint); m != nil {
+			v, err := strconv.Atoi(m[1])
+			return v, err == nil
+		}
+	}
+	return 0, false
+}
+
+// derivedEndpointPath is the path of a derived endpoint below its parent endpoint for the servers with the api version
+// apiVersion and a server version of at least since
+type derivedEndpointPath struct {
+	apiVersion int
+	since      Version
+	path       string
+}
+
+// derivedEndpointPaths holds the paths of the endpoints whose urls are derived from another endpoint's url, ordered by
+// server version; so far, all server versions use the same paths. A path is added when a server release moves an
+// endpoint.
+var derivedEndpointPaths = map[EndpointName][]derivedEndpointPath{
+	EndpointMytokenTags: {
+		{
+			apiVersion: 0,
+			path:       "tags",
+		},
+	},
+	EndpointCalendars: {
+		{
+			apiVersion: 0,
+			path:       "calendars",
+		},
+	},
+}
+
+// derivedPath returns the path of the passed derived endpoint below its parent endpoint for the server with the passed
+// metadata, see derivedEndpointPaths. Servers that do not advertise their version are assumed to be up to date;
+// servers that do not advertise their api version are assumed to implement the SupportedAPIVersion.
+func derivedPath(endpoint EndpointName, metadata api.MytokenConfiguration) string {
+	paths := derivedEndpointPaths[endpoint]
+	if len(paths) == 0 {
+		return ""
+	}
+	apiV, ok := apiVersion(metadata)
+	if !ok {
+		apiV = SupportedAPIVersion
+	}
+	serverVersion, err := ParseVersion(metadata.Version)
+	versionKnown := metadata.Version != "" && err == nil
+	path := ""
+	for _, p := range paths {
+		if p.apiVersion != apiV || (versionKnown && serverVersion.Before(p.since)) {
+			continue
+		}
+		path = p.path
+	}
+	if path == "" {
+		// an api version or server version that is not in the table; the newest path is the best guess
+		path = paths[len(paths)-1].path
+	}
+	return path
+}
+
+// WithVersionCheck enables or disables the check that the server advertises the api version this library implements
+// (see SupportedAPIVersion); it is enabled by default. If the check fails, creating the MytokenServer fails with an
+// error matching ErrIncompatibleServer.
+func WithVersionCheck(enabled bool) Option {
+	return func(c *client) error {
+		c.skipVersionCheck = !enabled
+		return nil
+	}
+}
+
+// checkCompatibility checks that the server with the passed metadata advertises the SupportedAPIVersion
+func (c *client) checkCompatibility(metadata api.MytokenConfiguration) error {
+	if c.skipVersionCheck {
+		return nil
+	}
+	v, ok := apiVersion(metadata)
+	if !ok || v == SupportedAPIVersion {
+		return nil
+	}
+	return MytokenError{
+		err: ErrIncompatibleServer.err,
+		errorDetails: fmt.Sprintf(
+			"%s implements api version %d, this library supports api version %d", serverDescription(metadata), v,
+			SupportedAPIVersion,
+		),
+	}
+}
+
+// decodingError returns the error for a response that could not be decoded; responses whose values do not match the
+// types of the api are reported as incompatibility
+func (c *client) decodingError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(err, &typeErr) {
+		return newMytokenErrorFromError(errDecodingHttpResponse, err)
+	}
+	server := "the server"
+	if c != nil && c.metadata != nil {
+		server = serverDescription(*c.metadata)
+	}
+	return MytokenError{
+		err: ErrIncompatibleServer.err,
+		errorDetails: fmt.Sprintf(
+			"the response of %s does not match the api types of this library: %s", server, err.Error(),
+		),
+	}
+}
+
+// serverDescription describes the server with the passed metadata including its version, if known, for error
+// messages
+func serverDescription(metadata api.MytokenConfiguration) string {
+	if metadata.Version == "" {
+		return "the server (unknown version)"
+	}
+	return "the server (version " + metadata.Version + ")"
+}
@@ -0,0 +1,190 @@
+package mytokenlib
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/oidc-mytoken/api/v0"
+)
+
+func TestVersionAtLeast(t *testing.T) {
+	tests := []struct {
+		older, newer string
+	}{
+		{older: "0.9.9", newer: "0.10.0"},
+		{older: "0.10.0-rc1", newer: "0.10.0"},
+		{older: "0.10.0-alpha", newer: "0.10.0-alpha.1"},
+		{older: "0.10.0-alpha.1", newer: "0.10.0-alpha.beta"},
+		{older: "0.10.0-alpha.beta", newer: "0.10.0-beta"},
+		{older: "0.10.0-beta.2", newer: "0.10.0-beta.11"},
+		{older: "0.10.0-rc.1", newer: "0.10.0-rc.10"},
+		{older: "0.10.0-rc9", newer: "0.10.0-rc10"},
+		{older: "0.10.0-1", newer: "0.10.0-rc"},
+	}
+	for _, test := range tests {
+		older, err := ParseVersion(test.older)
+		if err != nil {
+			t.Fatalf("could not parse %q: %s", test.older, err)
+		}
+		newer, err := ParseVersion(test.newer)
+		if err != nil {
+			t.Fatalf("could not parse %q: %s", test.newer, err)
+		}
+		if !newer.AtLeast(older) || newer.Before(older) {
+			t.Errorf("expected %s to be newer than %s", newer, older)
+		}
+		if older.AtLeast(newer) {
+			t.Errorf("expected %s to be older than %s", older, newer)
+		}
+		if !older.AtLeast(older) {
+			t.Errorf("expected %s to be at least itself", older)
+		}
+	}
+}
+
+func TestDiscoveryReportsIncompatibleServer(t *testing.T) {
+	srv := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, http.StatusOK, map[string]any{"issuer": 1})
+			},
+		),
+	)
+	defer srv.Close()
+	for name, opts := range map[string][]Option{
+		"without cache": nil,
+		"with cache":    {WithDiscoveryCacheDir(t.TempDir())},
+	} {
+		_, err := NewMytokenServerWithOptions(srv.URL, opts...)
+		if !errors.Is(err, ErrIncompatibleServer) {
+			t.Errorf("%s: expected an error matching ErrIncompatibleServer, got: %v", name, err)
+		}
+	}
+}
+
+func TestDerivedEndpointPaths(t *testing.T) {
+	paths := derivedEndpointPaths
+	derivedEndpointPaths = map[EndpointName][]derivedEndpointPath{
+		EndpointMytokenTags: {
+			{
+				apiVersion: 0,
+				path:       "tags",
+			},
+			{
+				apiVersion: 0,
+				since:      Version{Minor: 12},
+				path:       "tag-list",
+			},
+			{
+				apiVersion: 1,
+				path:       "labels",
+			},
+		},
+		EndpointCalendars: {
+			{
+				apiVersion: 0,
+				path:       "calendars",
+			},
+			{
+				apiVersion: 0,
+				since:      Version{Minor: 12},
+				path:       "ics",
+			},
+		},
+	}
+	t.Cleanup(
+		func() {
+			derivedEndpointPaths = paths
+		},
+	)
+	tests := []struct {
+		name              string
+		version           string
+		apiVersion        string
+		expectedTags      string
+		expectedCalendars string
+	}{
+		{
+			name:              "older server",
+			version:           "0.11.3",
+			expectedTags:      "token/my/tags",
+			expectedCalendars: "notifications/calendars",
+		},
+		{
+			name:              "newer server",
+			version:           "0.12.0",
+			expectedTags:      "token/my/tag-list",
+			expectedCalendars: "notifications/ics",
+		},
+		{
+			name:              "pre-release of the newer server",
+			version:           "0.12.0-rc1",
+			expectedTags:      "token/my/tags",
+			expectedCalendars: "notifications/calendars",
+		},
+		{
+			name:              "unknown server version",
+			expectedTags:      "token/my/tag-list",
+			expectedCalendars: "notifications/ics",
+		},
+		{
+			name:       "other api version",
+			version:    "1.0.0",
+			apiVersion: "v1",
+			// there is no calendars path for api version 1, so the newest one is used
+			expectedTags:      "token/my/labels",
+			expectedCalendars: "notifications/ics",
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				srv := newTestServer(
+					t, nil, func(metadata *api.MytokenConfiguration) {
+						metadata.Version = test.version
+						metadata.NotificationsEndpoint = metadata.Issuer + testAPIPath + "/notifications"
+						if test.apiVersion != "" {
+							metadata.MytokenEndpoint = strings.Replace(
+								metadata.MytokenEndpoint, "/v0/", "/"+test.apiVersion+"/", 1,
+							)
+						}
+					},
+				)
+				server, err := NewMytokenServerWithOptions(srv.URL, WithVersionCheck(false))
+				if err != nil {
+					t.Fatalf("could not create mytoken server: %s", err)
+				}
+				if tags := server.Mytoken.tagsEndpoint; !strings.HasSuffix(tags, "/"+test.expectedTags) {
+					t.Errorf("expected the tags endpoint to end with %q, got %q", test.expectedTags, tags)
+				}
+				calendars, err := server.Calendars.endpoint.get()
+				if err != nil {
+					t.Fatalf("could not resolve the calendars endpoint: %s", err)
+				}
+				if !strings.HasSuffix(calendars, testAPIPath+"/"+test.expectedCalendars) {
+					t.Errorf(
+						"expected the calendars endpoint to end with %q, got %q", test.expectedCalendars, calendars,
+					)
+				}
+			},
+		)
+	}
+}
+
+func TestDerivedEndpointPathsOfKnownServers(t *testing.T) {
+	for _, version := range []string{"0.9.0", "0.12.1", ""} {
+		metadata := api.MytokenConfiguration{
+			Version:         version,
+			MytokenEndpoint: "https://mytoken.example.com/api/v0/token/my",
+		}
+		if path := derivedPath(EndpointMytokenTags, metadata); path != "tags" {
+			t.Errorf("%q: expected the tags path %q, got %q", version, "tags", path)
+		}
+		if path := derivedPath(EndpointCalendars, metadata); path != "calendars" {
+			t.Errorf("%q: expected the calendars path %q, got %q", version, "calendars", path)
+		}
+	}
+}
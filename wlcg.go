@@ -0,0 +1,88 @@
+package mytokenlib
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Environment variables used by the WLCG Bearer Token Discovery
+const (
+	EnvBearerToken     = "BEARER_TOKEN"
+	EnvBearerTokenFile = "BEARER_TOKEN_FILE"
+	envXDGRuntimeDir   = "XDG_RUNTIME_DIR"
+)
+
+// wlcgFallbackDir is the directory of the bearer token file if XDG_RUNTIME_DIR is not set
+var wlcgFallbackDir = "/tmp"
+
+// wlcgBearerTokenFileName returns the file name of the bearer token file of the current user, i.e. bt_u$UID
+func wlcgBearerTokenFileName() string {
+	return "bt_u" + strconv.Itoa(os.Getuid())
+}
+
+// WLCGBearerTokenFile returns the path of the file a bearer token should be stored in according to the WLCG Bearer
+// Token Discovery: $BEARER_TOKEN_FILE if set, otherwise $XDG_RUNTIME_DIR/bt_u$UID if XDG_RUNTIME_DIR is set,
+// otherwise /tmp/bt_u$UID.
+func WLCGBearerTokenFile() string {
+	if f := os.Getenv(EnvBearerTokenFile); f != "" {
+		return f
+	}
+	if dir := os.Getenv(envXDGRuntimeDir); dir != "" {
+		return filepath.Join(dir, wlcgBearerTokenFileName())
+	}
+	return filepath.Join(wlcgFallbackDir, wlcgBearerTokenFileName())
+}
+
+// NewWLCGBearerTokenSink creates a new FileSink that keeps the access tokens obtained from the passed
+// AccessTokenSource in the file given by WLCGBearerTokenFile, readable only by the current user.
+// Note that tools following the WLCG Bearer Token Discovery prefer a token in the BEARER_TOKEN environment variable
+// over this file.
+func NewWLCGBearerTokenSink(source *AccessTokenSource) *FileSink {
+	return NewFileSink(
+		source, FileSinkTarget{
+			Path: WLCGBearerTokenFile(),
+			Mode: 0600,
+		},
+	)
+}
+
+// DiscoverWLCGBearerToken returns a bearer token following the WLCG Bearer Token Discovery; the token is taken from
+// the first of the following locations that provides one:
+//   - the BEARER_TOKEN environment variable
+//   - the file named by the BEARER_TOKEN_FILE environment variable
+//   - the file $XDG_RUNTIME_DIR/bt_u$UID, if XDG_RUNTIME_DIR is set
+//   - the file /tmp/bt_u$UID
+//
+// Additionally to the token, the location it was found at is returned, i.e. the name of the environment variable or
+// the path of the file. If no token is found ErrNoBearerToken is returned.
+func DiscoverWLCGBearerToken() (token, location string, err error) {
+	if t := strings.TrimSpace(os.Getenv(EnvBearerToken)); t != "" {
+		return t, EnvBearerToken, nil
+	}
+	files := []string{}
+	if f := os.Getenv(EnvBearerTokenFile); f != "" {
+		files = append(files, f)
+	}
+	if dir := os.Getenv(envXDGRuntimeDir); dir != "" {
+		files = append(files, filepath.Join(dir, wlcgBearerTokenFileName()))
+	}
+	files = append(files, filepath.Join(wlcgFallbackDir, wlcgBearerTokenFileName()))
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return "", f, newMytokenErrorFromError("could not read bearer token file", err)
+		}
+		if t := strings.TrimSpace(string(data)); t != "" {
+			return t, f, nil
+		}
+	}
+	return "", "", ErrNoBearerToken
+}
+
+// ErrNoBearerToken is returned by DiscoverWLCGBearerToken if no bearer token could be found
+var ErrNoBearerToken = MytokenError{err: "no bearer token found"}
@@ -0,0 +1,188 @@
+package mytokenlib
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setupWLCGDiscovery creates a directory with the files "file", "run/bt_u$UID", and "tmp/bt_u$UID" (if present in
+// files) and points the WLCG Bearer Token Discovery at it. Environment values may refer to the directory as {dir};
+// variables that are not passed are unset.
+func setupWLCGDiscovery(t *testing.T, env, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, sub := range []string{"run", "tmp"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, content := range files {
+		name = strings.ReplaceAll(name, "bt_u", wlcgBearerTokenFileName())
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{EnvBearerToken, EnvBearerTokenFile, envXDGRuntimeDir} {
+		t.Setenv(name, strings.ReplaceAll(env[name], "{dir}", dir))
+	}
+	fallbackDir := wlcgFallbackDir
+	wlcgFallbackDir = filepath.Join(dir, "tmp")
+	t.Cleanup(
+		func() {
+			wlcgFallbackDir = fallbackDir
+		},
+	)
+	return dir
+}
+
+func TestDiscoverWLCGBearerToken(t *testing.T) {
+	allFiles := map[string]string{
+		"file":     "file-token\n",
+		"run/bt_u": "runtime-token\n",
+		"tmp/bt_u": "tmp-token\n",
+	}
+	tests := []struct {
+		name          string
+		env           map[string]string
+		files         map[string]string
+		expectedToken string
+		// expectedLocation is an environment variable or a path relative to the test directory
+		expectedLocation string
+	}{
+		{
+			name: "environment variable first",
+			env: map[string]string{
+				EnvBearerToken:     " env-token\n",
+				EnvBearerTokenFile: "{dir}/file",
+				envXDGRuntimeDir:   "{dir}/run",
+			},
+			files:            allFiles,
+			expectedToken:    "env-token",
+			expectedLocation: EnvBearerToken,
+		},
+		{
+			name: "token file before runtime dir",
+			env: map[string]string{
+				EnvBearerToken:     " ",
+				EnvBearerTokenFile: "{dir}/file",
+				envXDGRuntimeDir:   "{dir}/run",
+			},
+			files:            allFiles,
+			expectedToken:    "file-token",
+			expectedLocation: "file",
+		},
+		{
+			name: "runtime dir before tmp",
+			env: map[string]string{
+				envXDGRuntimeDir: "{dir}/run",
+			},
+			files:            allFiles,
+			expectedToken:    "runtime-token",
+			expectedLocation: "run/bt_u",
+		},
+		{
+			name:             "tmp without runtime dir",
+			files:            allFiles,
+			expectedToken:    "tmp-token",
+			expectedLocation: "tmp/bt_u",
+		},
+		{
+			name: "missing token file falls through",
+			env: map[string]string{
+				EnvBearerTokenFile: "{dir}/missing",
+				envXDGRuntimeDir:   "{dir}/run",
+			},
+			files:            allFiles,
+			expectedToken:    "runtime-token",
+			expectedLocation: "run/bt_u",
+		},
+		{
+			name: "empty token file falls through",
+			env: map[string]string{
+				EnvBearerTokenFile: "{dir}/file",
+				envXDGRuntimeDir:   "{dir}/run",
+			},
+			files: map[string]string{
+				"file":     "\n",
+				"tmp/bt_u": "tmp-token",
+			},
+			expectedToken:    "tmp-token",
+			expectedLocation: "tmp/bt_u",
+		},
+		{
+			name: "no token",
+			env: map[string]string{
+				EnvBearerTokenFile: "{dir}/missing",
+				envXDGRuntimeDir:   "{dir}/run",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				dir := setupWLCGDiscovery(t, test.env, test.files)
+				token, location, err := DiscoverWLCGBearerToken()
+				if test.expectedToken == "" {
+					if !errors.Is(err, ErrNoBearerToken) {
+						t.Fatalf("expected ErrNoBearerToken, got %v", err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				expectedLocation := test.expectedLocation
+				if expectedLocation != EnvBearerToken {
+					expectedLocation = filepath.Join(
+						dir, strings.ReplaceAll(expectedLocation, "bt_u", wlcgBearerTokenFileName()),
+					)
+				}
+				if token != test.expectedToken || location != expectedLocation {
+					t.Errorf(
+						"expected %q from %q, got %q from %q", test.expectedToken, expectedLocation, token, location,
+					)
+				}
+			},
+		)
+	}
+}
+
+func TestWLCGBearerTokenFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		expected string
+	}{
+		{
+			name: "token file",
+			env: map[string]string{
+				EnvBearerTokenFile: "{dir}/file",
+				envXDGRuntimeDir:   "{dir}/run",
+			},
+			expected: "file",
+		},
+		{
+			name:     "runtime dir",
+			env:      map[string]string{envXDGRuntimeDir: "{dir}/run"},
+			expected: "run/bt_u",
+		},
+		{
+			name:     "tmp",
+			expected: "tmp/bt_u",
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				dir := setupWLCGDiscovery(t, test.env, nil)
+				expected := filepath.Join(dir, strings.ReplaceAll(test.expected, "bt_u", wlcgBearerTokenFileName()))
+				if path := WLCGBearerTokenFile(); path != expected {
+					t.Errorf("expected %q, got %q", expected, path)
+				}
+			},
+		)
+	}
+}